@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/audio/encodings"
+	"github.com/nice-pink/audio-tool/pkg/network"
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/load"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+)
+
+func main() {
+	log.Info("--- Start loadey ---")
+
+	// flags
+	url := flag.String("url", "", "Stream url")
+	clients := flag.Int("clients", 10, "Concurrent listeners.")
+	durationSec := flag.Int("durationSec", 60, "Test duration.")
+	rampUpSec := flag.Int("rampUpSec", 0, "[Optional] Start listeners evenly within seconds.")
+	lifetime := flag.String("lifetime", load.LifetimeFixed, "Connection lifetime distribution. [fixed, uniform, exponential]")
+	lifetimeSec := flag.Float64("lifetimeSec", 0, "[Optional] Mean connection lifetime. 0: until the end.")
+	lifetimeMinSec := flag.Float64("lifetimeMinSec", 0, "[Optional] Min connection lifetime of uniform distribution.")
+	churnDelaySec := flag.Float64("churnDelaySec", 0, "[Optional] Delay before a listener reconnects.")
+	timeout := flag.Int("timeout", 30, "Timeout. Default: 30sec")
+	validateSample := flag.Float64("validateSample", 0, "[Optional] Share of listeners running the encoding validator. [0-1]")
+	config := flag.String("config", "", "Config file with expectations. Required for validation.")
+	summaryFilepath := flag.String("summary", "", "[Optional] Write json summary to file. Default: stdout")
+	verbose := flag.Bool("verbose", false, "Verbose Logging.")
+	metrics := flag.Bool("metrics", false, "Add metrics.")
+	metricPrefix := flag.String("metricPrefix", "streamey_", "Metric prefix.")
+	metricPort := flag.Int("metricPort", 9090, "Metric port.")
+	flag.Parse()
+
+	if *url == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// start metrics server
+	metricsControl := util.MetricsControl{Enabled: false}
+	if *metrics {
+		metricsControl.Enabled = true
+		metricsControl.Prefix = *metricPrefix
+		metricsControl.Labels = map[string]string{"url": *url}
+		go metricmanager.NewServer(*metricPort, nil).Listen()
+	}
+
+	c := load.Config{
+		Url:            *url,
+		Clients:        *clients,
+		Duration:       time.Duration(*durationSec) * time.Second,
+		RampUp:         time.Duration(*rampUpSec) * time.Second,
+		Lifetime:       *lifetime,
+		LifetimeMin:    seconds(*lifetimeMinSec),
+		LifetimeMean:   seconds(*lifetimeSec),
+		ChurnDelay:     seconds(*churnDelaySec),
+		Timeout:        time.Duration(*timeout) * time.Second,
+		ValidateSample: *validateSample,
+	}
+	if *validateSample > 0 {
+		if *config == "" {
+			log.Error("Validation needs expectations, set -config.")
+			os.Exit(2)
+		}
+		expectations := configmanager.GetReadConfig(*config).Expectations.Expectations
+		expectations.Print()
+		c.NewValidator = func() network.DataValidator {
+			return encodings.NewEncodingValidator(true, false, expectations, metricsControl, *verbose)
+		}
+	}
+
+	generator := load.NewGenerator(c, metricsControl)
+	go StopOnSignal(generator)
+	summary := generator.Run()
+
+	// summary
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		log.Err(err, "summary")
+		os.Exit(1)
+	}
+	if *summaryFilepath == "" {
+		os.Stdout.Write(append(data, '\n'))
+		return
+	}
+	if err := os.WriteFile(*summaryFilepath, data, 0644); err != nil {
+		log.Err(err, "write summary", *summaryFilepath)
+		os.Exit(1)
+	}
+	log.Info("Summary written to", *summaryFilepath)
+}
+
+// StopOnSignal ends the test on SIGINT or SIGTERM, the summary is still written.
+func StopOnSignal(generator *load.Generator) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	log.Info("Received", sig, "stop load test")
+	generator.Stop()
+}
+
+func seconds(sec float64) time.Duration {
+	return time.Duration(sec * float64(time.Second))
+}
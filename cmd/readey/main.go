@@ -1,9 +1,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/nice-pink/audio-tool/pkg/audio/encodings"
@@ -12,8 +17,13 @@ import (
 	"github.com/nice-pink/goutil/pkg/filesystem"
 	"github.com/nice-pink/goutil/pkg/log"
 	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/latency"
+	"github.com/nice-pink/streamey/pkg/level"
+	"github.com/nice-pink/streamey/pkg/loudness"
 	"github.com/nice-pink/streamey/pkg/metricmanager"
 	"github.com/nice-pink/streamey/pkg/miniomanager"
+	"github.com/nice-pink/streamey/pkg/mp3"
+	"github.com/nice-pink/streamey/pkg/receiver"
 )
 
 var wg sync.WaitGroup
@@ -30,7 +40,7 @@ func main() {
 	// flags
 	url := flag.String("url", "", "Stream url")
 	timeout := flag.Int("timeout", 30, "Timeout. Default: 30sec")
-	validate := flag.String("validate", "", "Validation type. [audio, privateBit]")
+	validate := flag.String("validate", "", "Validation type. [audio, privateBit, latency, silence, loudness]")
 	outputFilepath := flag.String("outputFilepath", "", "[Optional] Output file path, if data should be dumped to file.")
 	reconnect := flag.Bool("reconnect", false, "[Optional] Reconnect on any interruption.")
 	minioConfig := flag.String("minioConfig", "", "[Optional] Json config file for minio. Use minio if defined.")
@@ -47,38 +57,121 @@ func main() {
 		c = configmanager.GetReadConfig(*config)
 	}
 
-	// start metrics server
+	// streams of the config or of the flags
+	streams := c.GetStreams()
+	if len(streams) == 0 {
+		streams = []configmanager.MonitoredStream{{
+			Name:           *url,
+			Url:            *url,
+			Validate:       *validate,
+			Expectations:   &c.Expectations,
+			Silence:        &c.Silence,
+			OutputFilepath: *outputFilepath,
+			Labels:         map[string]string{},
+		}}
+	} else if *url != "" {
+		log.Warn("Streams of config are read, ignore -url", *url)
+	}
+
+	// every stream has its own status and metric labels
+	statuses := map[string]*receiver.Status{}
 	metricsControl := util.MetricsControl{Enabled: false}
 	if *metrics {
+		metricsControl.Enabled = true
 		metricsControl.Prefix = *metricPrefix
-		metricsControl.Labels = map[string]string{"url": *url}
-		go metricmanager.Listen(*metricPort)
 	}
+	for _, stream := range streams {
+		statuses[stream.Name] = receiver.NewStatus(time.Duration(*timeout)*time.Second, nil)
+	}
+
+	// start metrics server, health endpoints are served without metrics, too
+	ready := func() map[string]metricmanager.Check {
+		checks := map[string]metricmanager.Check{}
+		for name, status := range statuses {
+			checks[name] = status.Check()
+		}
+		return checks
+	}
+	server := metricmanager.NewHealthServer(*metricPort, ready)
+	if *metrics {
+		server = metricmanager.NewServer(*metricPort, ready)
+	}
+	go server.Listen()
+	go ShutdownOnSignal(server)
 
-	// read stream
-	go ReadStream(*url, *outputFilepath, *reconnect, false, *timeout, c, *validate, metricsControl, *verbose)
+	// read streams
+	for _, stream := range streams {
+		wg.Add(1)
+		go ReadStream(stream, *reconnect, false, *timeout, StreamMetrics(metricsControl, stream, len(c.Streams) > 0), statuses[stream.Name], *verbose)
+	}
 
 	// start minio sync
-	goRoutineCounter := 1
 	if *minioConfig != "" {
-		goRoutineCounter++
-
-		go ManageMinio(c, delay, *outputFilepath, *minioCleanUpAfterSec, *reconnect)
+		folders := []string{}
+		for _, stream := range streams {
+			if stream.OutputFilepath != "" {
+				folders = append(folders, stream.OutputFilepath)
+			}
+		}
+		wg.Add(1)
+		go ManageMinio(c, delay, folders, *minioCleanUpAfterSec, *reconnect)
 	}
 
 	// wait for go routines to be done
-	wg.Add(goRoutineCounter)
 	wg.Wait()
 }
 
+// StreamMetrics returns metrics control labelled by the url and, for streams
+// of the config, by name and labels of stream.
+func StreamMetrics(control util.MetricsControl, stream configmanager.MonitoredStream, fromConfig bool) util.MetricsControl {
+	control = metricmanager.WithLabel(control, "url", stream.Url)
+	if !fromConfig {
+		return control
+	}
+	for name, value := range stream.Labels {
+		control = metricmanager.WithLabel(control, name, value)
+	}
+	return metricmanager.WithLabel(control, "stream", stream.Name)
+}
+
 // stream
 
-func ReadStream(url string, outputFilepath string, reconnect, failEarly bool, timeout int, config configmanager.ReadConfig, validate string, metricsControl util.MetricsControl, verbose bool) {
+// ReadStream reads and validates stream until it ends. Streams are read
+// independently, every stream reconnects on its own.
+func ReadStream(stream configmanager.MonitoredStream, reconnect, failEarly bool, timeout int, metricsControl util.MetricsControl, status *receiver.Status, verbose bool) {
+	defer wg.Done()
+	url := stream.Url
+	validate := strings.ToLower(stream.Validate)
+	if validate == "latency" || validate == "silence" || validate == "loudness" {
+		var handler receiver.FrameHandler
+		var checker receiver.Checker
+		switch validate {
+		case "latency":
+			log.Info("### Latency measurement", stream.Name)
+			meter := latency.NewMeter(metricsControl)
+			handler, checker = meter, meter
+		case "silence":
+			log.Info("### Silence detection", stream.Name)
+			detector := level.NewDetector(*stream.Silence, metricsControl)
+			handler, checker = mp3.NewPcmHandler(detector), detector
+		default:
+			log.Info("### Loudness measurement", stream.Name)
+			meter := loudness.NewMeter(stream.Expectations.Loudness, metricsControl)
+			handler, checker = mp3.NewPcmHandler(meter), meter
+		}
+		status.SetChecker(checker)
+		err := receiver.Receive(url, time.Duration(timeout)*time.Second, reconnect, handler, status)
+		if err != nil {
+			log.Err(err, "receive stream", url)
+		}
+		return
+	}
+
 	connection := network.NewConnection(url, "", 80, 0, time.Duration(timeout), network.HttpConnection, metricsControl)
 	var validator network.DataValidator
-	if strings.ToLower(validate) == "audio" {
+	if validate == "audio" {
 		log.Newline()
-		log.Info("### Audio validation")
+		log.Info("### Audio validation", stream.Name)
 		// expectations := audio.Expectations{
 		// 	IsCBR: true,
 		// 	Encoding: audio.Encoding{
@@ -86,23 +179,36 @@ func ReadStream(url string, outputFilepath string, reconnect, failEarly bool, ti
 		// 		IsStereo: true,
 		// 	},
 		// }
-		expectations := config.Expectations
+		expectations := stream.Expectations.Expectations
 		expectations.Print()
 		log.Info("###")
 		log.Newline()
 		validator = encodings.NewEncodingValidator(true, failEarly, expectations, metricsControl, verbose)
-	} else if strings.ToLower(validate) == "privatebit" {
+	} else if validate == "privatebit" {
 		validator = encodings.NewPrivateBitValidator(true, encodings.GuessAudioType(url), metricsControl, verbose)
 	} else {
 		validator = network.DummyValidator{}
 	}
-	connection.ReadStream(outputFilepath, reconnect, validator)
-	wg.Done()
+	// data and validation results update the status
+	connection.ReadStream(stream.OutputFilepath, reconnect, receiver.NewValidator(validator, status))
+	status.Interrupted(errors.New("read stream ended"))
+	log.Warn("Read stream ended", stream.Name)
+}
+
+// ShutdownOnSignal stops the metric server gracefully and exits on SIGINT or
+// SIGTERM.
+func ShutdownOnSignal(server *metricmanager.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	log.Info("Received", sig, "shut down")
+	server.Shutdown()
+	os.Exit(0)
 }
 
 // minio
 
-func ManageMinio(config configmanager.ReadConfig, delay int64, localFolder string, minioCleanUpAfterSec int64, loop bool) {
+func ManageMinio(config configmanager.ReadConfig, delay int64, localFolders []string, minioCleanUpAfterSec int64, loop bool) {
 	useSsl := true
 	m := miniomanager.NewMinioManager(config.Minio, useSsl)
 
@@ -113,7 +219,9 @@ func ManageMinio(config configmanager.ReadConfig, delay int64, localFolder strin
 		time.Sleep(duration)
 
 		// push
-		PushFiles(m, localFolder)
+		for _, localFolder := range localFolders {
+			PushFiles(m, localFolder)
+		}
 
 		// delete
 		//day := int64(3600 * 24)
@@ -130,6 +238,6 @@ func PushFiles(m *miniomanager.MinioManger, folder string) {
 	files := filesystem.ListFiles(folder, 0, true)
 
 	for _, file := range files {
-		m.PutFile(bucket, minioFolder, folder, file, true)
+		m.PutFile(bucket, minioFolder, folder, filepath.Base(file), true)
 	}
 }
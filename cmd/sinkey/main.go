@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/mocksink"
+)
+
+func main() {
+	log.Info("--- Start sinkey ---")
+
+	// flags
+	port := flag.Int("port", 8090, "Port.")
+	status := flag.Int("status", http.StatusOK, "Response status of metadata requests.")
+	expectationsFilepath := flag.String("expectations", "", "[Optional] Json file with expectations.")
+	durationSec := flag.Int("durationSec", 0, "[Optional] Stop after seconds. Default: until SIGINT or SIGTERM.")
+	reportFilepath := flag.String("report", "", "[Optional] Write json report to file.")
+	flag.Parse()
+
+	sink := mocksink.New()
+	sink.SetStatus(*status)
+	if *expectationsFilepath != "" {
+		data, err := os.ReadFile(*expectationsFilepath)
+		if err != nil {
+			log.Err(err, "read expectations")
+			os.Exit(2)
+		}
+		var expectations []mocksink.Expectation
+		if err := json.Unmarshal(data, &expectations); err != nil {
+			log.Err(err, "parse expectations")
+			os.Exit(2)
+		}
+		sink.Expect(expectations...)
+	}
+
+	portString := ":" + strconv.Itoa(*port)
+	log.Info("Mock sink on", portString, "query api on", mocksink.API_PREFIX)
+	go func() {
+		if err := http.ListenAndServe(portString, sink); err != nil {
+			log.Err(err, "mock sink")
+			os.Exit(2)
+		}
+	}()
+
+	// wait
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	var timeout <-chan time.Time
+	if *durationSec > 0 {
+		timeout = time.After(time.Duration(*durationSec) * time.Second)
+	}
+	select {
+	case sig := <-signals:
+		log.Info("Received", sig)
+	case <-timeout:
+	}
+
+	report := sink.Report()
+	fmt.Print(report)
+	if *reportFilepath != "" {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(*reportFilepath, data, 0644); err != nil {
+			log.Err(err, "write report")
+		}
+	}
+	if !report.Passed {
+		os.Exit(1)
+	}
+}
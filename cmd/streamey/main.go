@@ -2,15 +2,21 @@ package main
 
 import (
 	"flag"
-	"sync"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/nice-pink/audio-tool/pkg/util"
 	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/api"
 	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/metadata"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
 	"github.com/nice-pink/streamey/pkg/streamer"
 )
 
-var wg sync.WaitGroup
+const CONFIG_POLL_INTERVAL time.Duration = 5 * time.Second
 
 func main() {
 	log.Info("--- Start streamey ---")
@@ -27,21 +33,36 @@ func main() {
 	verbose := flag.Bool("verbose", false, "Verbose logging.")
 	// isIcecast := flag.Bool("icecast", false, "Send icecast.")
 	// validateTest := flag.String("validateTest", "", "Validation test.")
-	// metrics := flag.Bool("metrics", false, "Add metrics.")
-	// metricPrefix := flag.String("metricPrefix", "streamey_", "Metric prefix.")
-	// metricPort := flag.Int("metricPort", 9090, "Metric port.")
+	metrics := flag.Bool("metrics", false, "Add metrics.")
+	metricPrefix := flag.String("metricPrefix", "streamey_", "Metric prefix.")
+	metricPort := flag.Int("metricPort", 9090, "Metric port.")
 	configFilepath := flag.String("config", "", "Config filepath")
+	controlApi := flag.Bool("api", false, "Serve control api.")
+	apiPort := flag.Int("apiPort", 8080, "Control api port.")
+	replaySink := flag.String("sink", "", "[replay] Target sink of the config as channel/sink.")
+	replayUrl := flag.String("url", "", "[replay] Target url, instead of a sink.")
+	replayFrom := flag.String("from", "", "[replay] Only replay requests captured for this sink.")
+	replaySpeed := flag.Float64("speed", 1, "[replay] Speed factor, 0 sends without delay.")
+	replayRetries := flag.Bool("retries", false, "[replay] Also replay captured retries.")
+	replayNewKeys := flag.Bool("newKeys", false, "[replay] Send with new idempotency keys.")
 	flag.Parse()
 
-	// start metrics server
+	// metrics are labelled by channel
 	metricsControl := util.MetricsControl{Enabled: false}
-	// if *metrics {
-	// 	metricsControl.Prefix = *metricPrefix
-	// 	metricsControl.Labels = map[string]string{"url": *url}
-	// 	go metricmanager.Listen(*metricPort)
-	// }
+	if *metrics {
+		metricsControl.Enabled = true
+		metricsControl.Prefix = *metricPrefix
+	}
+
+	if flag.Arg(0) == "replay" {
+		options := metadata.ReplayOptions{Speed: *replaySpeed, Retries: *replayRetries, NewKeys: *replayNewKeys}
+		os.Exit(Replay(flag.Arg(1), *configFilepath, *replaySink, *replayUrl, *replayFrom, options))
+	}
 
 	config := configmanager.GetStreamConfig(*configFilepath)
+	if flag.Arg(0) == "validate-templates" {
+		os.Exit(ValidateTemplates(config))
+	}
 
 	// streamUrl := *url
 	// if *test {
@@ -51,10 +72,102 @@ func main() {
 	// 	streamUrl = "localhost:9999"
 	// }
 
+	manager := streamer.NewManager(metricsControl, *verbose)
+	manager.Apply(config)
+
+	// start metrics server, ready if all channels are connected. Health
+	// endpoints are served without metrics, too.
+	server := metricmanager.NewHealthServer(*metricPort, manager.Readiness)
+	if *metrics {
+		server = metricmanager.NewServer(*metricPort, manager.Readiness)
+	}
+	go server.Listen()
+	go ShutdownOnSignal(server, manager)
+
+	if *controlApi {
+		go api.Listen(*apiPort, manager)
+	}
+
+	// hot reload on config change or SIGHUP
+	configmanager.WatchStreamConfig(*configFilepath, CONFIG_POLL_INTERVAL, manager.Apply)
+}
+
+// ValidateTemplates renders and validates the metadata of all playlist items
+// offline and returns the exit code.
+func ValidateTemplates(config configmanager.StreamsConfig) int {
+	failed := 0
 	for _, item := range config.Items {
-		go streamer.Stream(item, metricsControl, &wg, *verbose)
-		wg.Add(1)
+		for _, err := range metadata.CheckTemplates(item) {
+			log.Err(err, "template check failed")
+			failed++
+		}
 	}
+	if failed > 0 {
+		log.Error(failed, "templates failed")
+		return 1
+	}
+	log.Info("All templates valid.")
+	return 0
+}
+
+// Replay sends the captured metadata requests of file to sinkName of the
+// config or to url and returns the exit code.
+func Replay(file string, configFilepath string, sinkName string, url string, from string, options metadata.ReplayOptions) int {
+	entries, err := metadata.ReadCapture(file)
+	if err != nil {
+		log.Err(err, "cannot read capture", file)
+		return 1
+	}
+	if from != "" {
+		filtered := []metadata.CaptureEntry{}
+		for _, entry := range entries {
+			if entry.Sink == from {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+
+	sink := configmanager.MetadataSink{Name: "replay", TargetUrl: url}
+	if sinkName != "" {
+		config := configmanager.GetStreamConfig(configFilepath)
+		found := false
+		for _, channel := range config.Items {
+			for _, s := range channel.Metadata.GetSinks(channel.Playlist.ContentType) {
+				if channel.ChannelName+"/"+s.Name == sinkName {
+					sink, found = s, true
+				}
+			}
+		}
+		if !found {
+			log.Error("Sink not found", sinkName)
+			return 1
+		}
+		if url != "" {
+			sink.TargetUrl = url
+		}
+	}
+	if sink.Type != configmanager.SinkTypeUecp && sink.TargetUrl == "" {
+		log.Error("No replay target, set -sink or -url.")
+		return 1
+	}
+
+	log.Info("Replay", len(entries), "captured metadata requests to", sink.Name)
+	if failed := metadata.Replay(entries, sink, options); failed > 0 {
+		log.Error(failed, "replayed requests failed")
+		return 1
+	}
+	return 0
+}
 
-	wg.Wait()
+// ShutdownOnSignal stops all channels and the metric server gracefully and
+// exits on SIGINT or SIGTERM.
+func ShutdownOnSignal(server *metricmanager.Server, manager *streamer.Manager) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	log.Info("Received", sig, "shut down")
+	manager.StopAll()
+	server.Shutdown()
+	os.Exit(0)
 }
@@ -5,6 +5,7 @@ go 1.23.2
 toolchain go1.24.1
 
 require (
+	github.com/google/uuid v1.5.0
 	github.com/minio/minio-go/v7 v7.0.66
 	github.com/nice-pink/audio-tool v0.0.2-0.20250419135938-a1cfd8cd5428
 	github.com/nice-pink/goutil v0.3.9
@@ -15,7 +16,6 @@ require (
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
-	github.com/google/uuid v1.5.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.6 // indirect
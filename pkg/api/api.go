@@ -0,0 +1,167 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/streamer"
+)
+
+//go:embed openapi.json
+var openapi []byte
+
+type Item struct {
+	Type        string  `json:"type"`
+	Artist      string  `json:"artist"`
+	Title       string  `json:"title"`
+	Album       string  `json:"album"`
+	Filepath    string  `json:"filepath"`
+	DurationSec float64 `json:"durationSec"`
+}
+
+type Channel struct {
+	Name        string    `json:"name"`
+	State       string    `json:"state"`
+	Index       int       `json:"index"`
+	Item        Item      `json:"item"`
+	ItemStarted time.Time `json:"itemStarted"`
+	Started     time.Time `json:"started"`
+	UptimeSec   float64   `json:"uptimeSec"`
+	Loops       int       `json:"loops"`
+}
+
+type JumpRequest struct {
+	Index int `json:"index"`
+}
+
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Handler returns the control api for the channels of manager. All calls are
+// safe while channels are streaming.
+func Handler(manager *streamer.Manager) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		w.Write(openapi)
+	})
+	mux.HandleFunc("GET /channels", func(w http.ResponseWriter, r *http.Request) {
+		channels := []Channel{}
+		for _, channel := range manager.Channels() {
+			channels = append(channels, toChannel(channel.Status()))
+		}
+		writeJson(w, http.StatusOK, channels)
+	})
+	mux.HandleFunc("GET /channels/{name}", func(w http.ResponseWriter, r *http.Request) {
+		channel := manager.Channel(r.PathValue("name"))
+		if channel == nil {
+			writeError(w, streamer.ErrUnknownChannel)
+			return
+		}
+		writeJson(w, http.StatusOK, toChannel(channel.Status()))
+	})
+	mux.HandleFunc("GET /channels/{name}/nowplaying", nowPlaying(manager))
+	mux.HandleFunc("GET /channels/{name}/nowplaying/events", nowPlayingEvents(manager))
+	mux.HandleFunc("POST /channels/{name}/start", control(manager, manager.Start))
+	mux.HandleFunc("POST /channels/{name}/stop", control(manager, manager.Stop))
+	mux.HandleFunc("POST /channels/{name}/skip", control(manager, manager.Skip))
+	mux.HandleFunc("POST /channels/{name}/metadata", control(manager, manager.PushMetadata))
+	mux.HandleFunc("POST /channels/{name}/jump", func(w http.ResponseWriter, r *http.Request) {
+		var req JumpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJson(w, http.StatusBadRequest, Error{Error: "invalid body: " + err.Error()})
+			return
+		}
+		name := r.PathValue("name")
+		if err := manager.Jump(name, req.Index); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeStatus(w, manager, name)
+	})
+	return mux
+}
+
+func Listen(port int, manager *streamer.Manager) {
+	portString := ":" + strconv.Itoa(port)
+	log.Info("Control api on", portString)
+	err := http.ListenAndServe(portString, Handler(manager))
+	if err != nil {
+		log.Err(err, "control api")
+	}
+}
+
+// helper
+
+func control(manager *streamer.Manager, fn func(name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if err := fn(name); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeStatus(w, manager, name)
+	}
+}
+
+func writeStatus(w http.ResponseWriter, manager *streamer.Manager, name string) {
+	channel := manager.Channel(name)
+	if channel == nil {
+		writeError(w, streamer.ErrUnknownChannel)
+		return
+	}
+	writeJson(w, http.StatusOK, toChannel(channel.Status()))
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, streamer.ErrUnknownChannel):
+		status = http.StatusNotFound
+	case errors.Is(err, streamer.ErrChannelRunning), errors.Is(err, streamer.ErrChannelStopped), errors.Is(err, streamer.ErrNoMetadata), errors.Is(err, streamer.ErrNotPlaying):
+		status = http.StatusConflict
+	case errors.Is(err, streamer.ErrInvalidIndex):
+		status = http.StatusBadRequest
+	}
+	writeJson(w, status, Error{Error: err.Error()})
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Err(err, "write response")
+	}
+}
+
+func toChannel(status streamer.ChannelStatus) Channel {
+	return Channel{
+		Name:        status.Name,
+		State:       status.State,
+		Index:       status.Index,
+		Item:        toItem(status.Item),
+		ItemStarted: status.ItemStarted,
+		Started:     status.Started,
+		UptimeSec:   status.Uptime.Seconds(),
+		Loops:       status.Loops,
+	}
+}
+
+func toItem(item configmanager.PlaylistItem) Item {
+	return Item{
+		Type:        item.Type,
+		Artist:      item.Artist,
+		Title:       item.Title,
+		Album:       item.Album,
+		Filepath:    item.Filepath,
+		DurationSec: item.Duration,
+	}
+}
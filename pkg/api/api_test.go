@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/streamer"
+	"github.com/nice-pink/streamey/pkg/template"
+)
+
+func TestOpenapi(t *testing.T) {
+	var doc map[string]any
+	if err := json.Unmarshal(openapi, &doc); err != nil {
+		t.Fatal("invalid openapi document", err)
+	}
+}
+
+func TestUnknownChannel(t *testing.T) {
+	handler := Handler(streamer.NewManager(util.MetricsControl{}, false))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/channels", http.StatusOK},
+		{http.MethodGet, "/channels/unknown", http.StatusNotFound},
+		{http.MethodPost, "/channels/unknown/start", http.StatusNotFound},
+		{http.MethodGet, "/channels/unknown/nowplaying", http.StatusNotFound},
+		{http.MethodGet, "/channels/unknown/nowplaying/events", http.StatusNotFound},
+		{http.MethodPost, "/channels/unknown/skip", http.StatusNotFound},
+		{http.MethodGet, "/channels/unknown/skip", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, nil))
+		if rec.Code != test.status {
+			t.Errorf("%s %s: got %d != want %d", test.method, test.path, rec.Code, test.status)
+		}
+	}
+}
+
+// Track has every field of the metadata templates.
+func TestTrackFields(t *testing.T) {
+	renamed := map[string]string{"TypeName": "Type", "Duration": "DurationSec"}
+	check := func(info reflect.Type, track reflect.Type) {
+		for i := 0; i < info.NumField(); i++ {
+			name := info.Field(i).Name
+			if to, ok := renamed[name]; ok {
+				name = to
+			}
+			if _, ok := track.FieldByName(name); !ok {
+				t.Errorf("%s misses field %s of %s", track.Name(), name, info.Name())
+			}
+		}
+	}
+	check(reflect.TypeOf(template.TrackInfo{}), reflect.TypeOf(Track{}))
+	check(reflect.TypeOf(template.ItemInfo{}), reflect.TypeOf(TrackItem{}))
+
+	info := template.TrackInfo{Sequence: 7, ChannelName: "channel1", Custom: map[string]string{"isrc": "x"}, Next: template.ItemInfo{Title: "next"}}
+	track := toTrack(info)
+	if track.Sequence != 7 || track.ChannelName != "channel1" || track.Custom["isrc"] != "x" || track.Next.Title != "next" {
+		t.Errorf("track: got %+v", track)
+	}
+}
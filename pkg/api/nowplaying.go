@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/streamer"
+	"github.com/nice-pink/streamey/pkg/template"
+)
+
+const (
+	NOWPLAYING_EVENT string        = "nowplaying"
+	KEEPALIVE        time.Duration = 15 * time.Second
+)
+
+// Track has the fields of the metadata templates, see template.TrackInfo.
+type Track struct {
+	Uuid        string            `json:"uuid"`
+	Id          string            `json:"id"`
+	Sequence    int64             `json:"sequence"`
+	Type        string            `json:"type"`
+	TypeId      string            `json:"typeId"`
+	Artist      string            `json:"artist"`
+	Title       string            `json:"title"`
+	Album       string            `json:"album"`
+	Filepath    string            `json:"filepath"`
+	DurationSec float64           `json:"durationSec"`
+	Custom      map[string]string `json:"custom,omitempty"`
+	LastStarted bool              `json:"lastStarted"`
+	Start       time.Time         `json:"start"`
+	Stop        time.Time         `json:"stop"`
+	ChannelName string            `json:"channelName"`
+	LoopCount   int               `json:"loopCount"`
+	ItemIndex   int               `json:"itemIndex"`
+	Bitrate     int               `json:"bitrate"`
+	SampleRate  int               `json:"sampleRate"`
+	Previous    TrackItem         `json:"previous"`
+	Next        TrackItem         `json:"next"`
+}
+
+// TrackItem is a neighbouring playlist item of a track.
+type TrackItem struct {
+	Type        string            `json:"type"`
+	TypeId      string            `json:"typeId"`
+	Artist      string            `json:"artist"`
+	Title       string            `json:"title"`
+	Album       string            `json:"album"`
+	Filepath    string            `json:"filepath"`
+	DurationSec float64           `json:"durationSec"`
+	Custom      map[string]string `json:"custom,omitempty"`
+}
+
+type NowPlaying struct {
+	Channel      string  `json:"channel"`
+	Current      Track   `json:"current"`
+	Next         *Track  `json:"next,omitempty"`
+	RemainingSec float64 `json:"remainingSec"`
+}
+
+func nowPlaying(manager *streamer.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playing, err := manager.NowPlaying(r.PathValue("name"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJson(w, http.StatusOK, toNowPlaying(playing))
+	}
+}
+
+// nowPlayingEvents streams server-sent events: the current state at once and
+// then on every item change. The stream ends, when the channel stops.
+func nowPlayingEvents(manager *streamer.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		updates, unsubscribe, err := manager.SubscribeNowPlaying(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer unsubscribe()
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeJson(w, http.StatusInternalServerError, Error{Error: "streaming not supported"})
+			return
+		}
+		// before the first item there is nothing to send yet
+		playing, err := manager.NowPlaying(name)
+		if err != nil && !errors.Is(err, streamer.ErrNotPlaying) {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("content-type", "text/event-stream")
+		w.Header().Set("cache-control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err != nil {
+			flusher.Flush()
+		} else if !writeEvent(w, flusher, playing) {
+			return
+		}
+
+		keepalive := time.NewTicker(KEEPALIVE)
+		defer keepalive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case playing, ok := <-updates:
+				if !ok || !writeEvent(w, flusher, playing) {
+					return
+				}
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// helper
+
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, playing streamer.NowPlaying) bool {
+	data, err := json.Marshal(toNowPlaying(playing))
+	if err != nil {
+		return false
+	}
+	_, err = fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", NOWPLAYING_EVENT, playing.Current.Uuid, data)
+	if err != nil {
+		return false
+	}
+	flusher.Flush()
+	return true
+}
+
+func toNowPlaying(playing streamer.NowPlaying) NowPlaying {
+	n := NowPlaying{
+		Channel:      playing.Channel,
+		Current:      toTrack(playing.Current),
+		RemainingSec: playing.Remaining.Seconds(),
+	}
+	if playing.Next != nil {
+		next := toTrack(*playing.Next)
+		n.Next = &next
+	}
+	return n
+}
+
+func toTrack(info template.TrackInfo) Track {
+	return Track{
+		Uuid:        info.Uuid,
+		Id:          info.Id,
+		Sequence:    info.Sequence,
+		Type:        info.TypeName,
+		TypeId:      info.TypeId,
+		Artist:      info.Artist,
+		Title:       info.Title,
+		Album:       info.Album,
+		Filepath:    info.Filepath,
+		DurationSec: info.Duration,
+		Custom:      info.Custom,
+		LastStarted: info.LastStarted,
+		Start:       info.Start,
+		Stop:        info.Stop,
+		ChannelName: info.ChannelName,
+		LoopCount:   info.LoopCount,
+		ItemIndex:   info.ItemIndex,
+		Bitrate:     info.Bitrate,
+		SampleRate:  info.SampleRate,
+		Previous:    toTrackItem(info.Previous),
+		Next:        toTrackItem(info.Next),
+	}
+}
+
+func toTrackItem(info template.ItemInfo) TrackItem {
+	return TrackItem{
+		Type:        info.TypeName,
+		TypeId:      info.TypeId,
+		Artist:      info.Artist,
+		Title:       info.Title,
+		Album:       info.Album,
+		Filepath:    info.Filepath,
+		DurationSec: info.Duration,
+		Custom:      info.Custom,
+	}
+}
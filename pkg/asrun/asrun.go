@@ -0,0 +1,211 @@
+package asrun
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/miniomanager"
+)
+
+const (
+	FormatJsonl string = "jsonl"
+	FormatCsv   string = "csv"
+
+	EventStart string = "start"
+	EventEnd   string = "end"
+
+	MetadataOk      string = "ok"
+	MetadataFailed  string = "failed"
+	MetadataSpooled string = "spooled"
+	MetadataPending string = "pending"
+	MetadataNone    string = "none"
+
+	ROTATE_SEC float64 = 3600
+)
+
+// Entry is one line of the as-run log. Actual stop and bytes are only known
+// at the end of an item.
+type Entry struct {
+	Channel      string     `json:"channel"`
+	Event        string     `json:"event"`
+	Index        int        `json:"index"`
+	Type         string     `json:"type"`
+	Artist       string     `json:"artist"`
+	Title        string     `json:"title"`
+	Album        string     `json:"album"`
+	Filepath     string     `json:"filepath"`
+	Duration     float64    `json:"duration"`
+	Fallback     bool       `json:"fallback"`
+	PlannedStart time.Time  `json:"plannedStart"`
+	PlannedStop  time.Time  `json:"plannedStop"`
+	ActualStart  time.Time  `json:"actualStart"`
+	ActualStop   *time.Time `json:"actualStop,omitempty"`
+	Bytes        int        `json:"bytes"`
+	Metadata     string     `json:"metadata"`
+}
+
+var csvHeader = []string{"channel", "event", "index", "type", "artist", "title", "album", "filepath", "duration", "fallback",
+	"plannedStart", "plannedStop", "actualStart", "actualStop", "bytes", "metadata"}
+
+func (e Entry) csvRecord() []string {
+	actualStop := ""
+	if e.ActualStop != nil {
+		actualStop = formatTime(*e.ActualStop)
+	}
+	return []string{e.Channel, e.Event, strconv.Itoa(e.Index), e.Type, e.Artist, e.Title, e.Album, e.Filepath,
+		strconv.FormatFloat(e.Duration, 'f', 3, 64), strconv.FormatBool(e.Fallback),
+		formatTime(e.PlannedStart), formatTime(e.PlannedStop), formatTime(e.ActualStart), actualStop,
+		strconv.Itoa(e.Bytes), e.Metadata}
+}
+
+// Logger writes entries of a channel to files in folder, which are rotated
+// after an interval. Rotated files are uploaded to minio, if configured.
+type Logger struct {
+	channelName string
+	folder      string
+	format      string
+	rotate      time.Duration
+	upload      configmanager.AsRunUpload
+	minio       *miniomanager.MinioManger
+
+	mu       sync.Mutex
+	file     *os.File
+	csv      *csv.Writer
+	filename string
+	opened   time.Time
+	uploads  sync.WaitGroup
+}
+
+func NewLogger(channelName string, config configmanager.AsRunConfig) (*Logger, error) {
+	if err := os.MkdirAll(config.Folder, 0755); err != nil {
+		return nil, err
+	}
+
+	format := strings.ToLower(config.Format)
+	if format == "" {
+		format = FormatJsonl
+	}
+	rotateSec := config.RotateSec
+	if rotateSec <= 0 {
+		rotateSec = ROTATE_SEC
+	}
+	l := &Logger{
+		channelName: channelName,
+		folder:      config.Folder,
+		format:      format,
+		rotate:      time.Duration(rotateSec * float64(time.Second)),
+		upload:      config.Upload,
+	}
+	if config.Upload.Enabled {
+		useSsl := true
+		l.minio = miniomanager.NewMinioManager(config.Upload.Minio, useSsl)
+		if l.minio == nil {
+			log.Error(channelName, "as-run upload disabled, no minio client")
+		}
+	}
+	return l, nil
+}
+
+func (l *Logger) Write(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil || time.Since(l.opened) >= l.rotate {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+
+	if l.format == FormatCsv {
+		if err := l.csv.Write(entry.csvRecord()); err != nil {
+			return err
+		}
+		l.csv.Flush()
+		return l.csv.Error()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the current file and waits for all uploads.
+func (l *Logger) Close() {
+	l.mu.Lock()
+	l.close(false)
+	l.mu.Unlock()
+	l.uploads.Wait()
+}
+
+// open rotates to a new file.
+func (l *Logger) open() error {
+	l.close(true)
+
+	now := time.Now().UTC()
+	filename := fileName(l.channelName, now, l.format)
+	file, err := os.OpenFile(filepath.Join(l.folder, filename), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	l.filename = filename
+	l.opened = now
+	log.Info(l.channelName, "as-run log", filepath.Join(l.folder, filename))
+
+	if l.format == FormatCsv {
+		l.csv = csv.NewWriter(file)
+		l.csv.Write(csvHeader)
+	}
+	return nil
+}
+
+func (l *Logger) close(async bool) {
+	if l.file == nil {
+		return
+	}
+	if err := l.file.Close(); err != nil {
+		log.Err(err, l.channelName, "close as-run log")
+	}
+	filename := l.filename
+	l.file = nil
+	l.csv = nil
+
+	if l.minio == nil {
+		return
+	}
+	l.uploads.Add(1)
+	upload := func() {
+		defer l.uploads.Done()
+		l.minio.PutFile(l.upload.Bucket, l.upload.Folder, l.folder, filename, l.upload.DeleteLocal)
+	}
+	if async {
+		go upload()
+	} else {
+		upload()
+	}
+}
+
+// helper
+
+func fileName(channelName string, t time.Time, format string) string {
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(channelName)
+	return name + "_" + t.Format("20060102T150405Z") + "." + format
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
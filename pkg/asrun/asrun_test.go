@@ -0,0 +1,93 @@
+package asrun
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+func testEntry() Entry {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stop := start.Add(30 * time.Second)
+	return Entry{
+		Channel:      "test",
+		Event:        EventEnd,
+		Index:        2,
+		Type:         "Ad",
+		Title:        "Spot, 30s",
+		Duration:     30,
+		PlannedStart: start,
+		PlannedStop:  stop,
+		ActualStart:  start,
+		ActualStop:   &stop,
+		Bytes:        480000,
+		Metadata:     MetadataOk,
+	}
+}
+
+func readLog(t *testing.T, folder string) []byte {
+	files, err := os.ReadDir(folder)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("log files: got %d, %v", len(files), err)
+	}
+	data, err := os.ReadFile(filepath.Join(folder, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestLoggerJsonl(t *testing.T) {
+	folder := t.TempDir()
+	l, err := NewLogger("test", configmanager.AsRunConfig{Folder: folder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := testEntry()
+	start.Event, start.ActualStop = EventStart, nil
+	l.Write(start)
+	l.Write(testEntry())
+	l.Close()
+
+	lines := strings.Split(strings.TrimSpace(string(readLog(t, folder))), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines: got %d", len(lines))
+	}
+	if strings.Contains(lines[0], "actualStop") {
+		t.Errorf("start entry with actual stop: %s", lines[0])
+	}
+	var entry Entry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Title != "Spot, 30s" || entry.Bytes != 480000 || entry.ActualStop == nil {
+		t.Errorf("end entry: got %+v", entry)
+	}
+}
+
+func TestLoggerCsv(t *testing.T) {
+	folder := t.TempDir()
+	l, err := NewLogger("test", configmanager.AsRunConfig{Folder: folder, Format: "CSV"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Write(testEntry())
+	l.Close()
+
+	records, err := csv.NewReader(strings.NewReader(string(readLog(t, folder)))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || len(records[1]) != len(csvHeader) {
+		t.Fatalf("records: got %v", records)
+	}
+	if records[1][5] != "Spot, 30s" || records[1][13] != "2024-05-01T12:00:30Z" {
+		t.Errorf("record: got %v", records[1])
+	}
+}
@@ -0,0 +1,95 @@
+package configmanager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MetaType maps item types to the id of a metadata sink. Names and aliases
+// are case insensitive. The default type is used for items without type.
+type MetaType struct {
+	Name    string
+	Id      int
+	Aliases []string
+	Default bool
+}
+
+type MetaTypes []MetaType
+
+// DefaultMetaTypes are used, if neither channel nor sink define types.
+var DefaultMetaTypes = MetaTypes{
+	{Name: "Song", Id: 1, Default: true},
+	{Name: "Spot", Id: 2},
+	{Name: "Link", Id: 3},
+	{Name: "VoiceTrack", Id: 4},
+	{Name: "Ad", Id: 5},
+}
+
+// Lookup returns the type of name or the default type, if name is empty.
+func (t MetaTypes) Lookup(name string) (MetaType, bool) {
+	for _, metaType := range t {
+		if name == "" && metaType.Default {
+			return metaType, true
+		}
+		if name == "" {
+			continue
+		}
+		if strings.EqualFold(metaType.Name, name) {
+			return metaType, true
+		}
+		for _, alias := range metaType.Aliases {
+			if strings.EqualFold(alias, name) {
+				return metaType, true
+			}
+		}
+	}
+	return MetaType{}, false
+}
+
+// Id returns the id of name as string or an empty string for unknown types.
+func (t MetaTypes) Id(name string) string {
+	metaType, ok := t.Lookup(name)
+	if !ok {
+		return ""
+	}
+	return strconv.Itoa(metaType.Id)
+}
+
+// Validate checks for duplicate names and aliases and multiple defaults.
+func (t MetaTypes) Validate() error {
+	names := map[string]bool{}
+	hasDefault := false
+	for _, metaType := range t {
+		if metaType.Name == "" {
+			return fmt.Errorf("meta type %d: name missing", metaType.Id)
+		}
+		for _, name := range append([]string{metaType.Name}, metaType.Aliases...) {
+			if names[strings.ToLower(name)] {
+				return fmt.Errorf("meta type %s: duplicate name or alias %s", metaType.Name, name)
+			}
+			names[strings.ToLower(name)] = true
+		}
+		if metaType.Default && hasDefault {
+			return fmt.Errorf("meta type %s: more than one default", metaType.Name)
+		}
+		hasDefault = hasDefault || metaType.Default
+	}
+	return nil
+}
+
+// validateTypes checks the meta type of all items.
+func validateTypes(types MetaTypes, items []PlaylistItem) error {
+	if err := types.Validate(); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if _, ok := types.Lookup(item.Type); !ok {
+			if item.Type == "" {
+				return fmt.Errorf("item %s: no type and no default meta type", item.Title)
+			}
+			return fmt.Errorf("item %s: unknown meta type %s", item.Title, item.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package configmanager
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetaTypes(t *testing.T) {
+	types := MetaTypes{
+		{Name: "Music", Id: 10, Aliases: []string{"song", "track"}, Default: true},
+		{Name: "Commercial", Id: 20, Aliases: []string{"ad", "spot"}},
+	}
+	tests := map[string]string{"Music": "10", "TRACK": "10", "": "10", "spot": "20", "VoiceTrack": ""}
+	for name, want := range tests {
+		if id := types.Id(name); id != want {
+			t.Errorf("%q: got %q, want %q", name, id, want)
+		}
+	}
+
+	if err := append(types, MetaType{Name: "Ad", Id: 30}).Validate(); err == nil {
+		t.Error("duplicate alias accepted")
+	}
+	if err := append(types, MetaType{Name: "Jingle", Id: 30, Default: true}).Validate(); err == nil {
+		t.Error("second default accepted")
+	}
+}
+
+func TestValidateMetaTypes(t *testing.T) {
+	config := StreamsConfig{Items: []StreamConfig{{
+		ChannelName: "test",
+		Audio:       AudioConfig{TargetUrl: "http://localhost", Bitrate: 128000},
+		Playlist:    Playlist{Items: []PlaylistItem{{Type: "Song"}, {Type: "Jingle"}}},
+	}}}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "Jingle") {
+		t.Errorf("unknown type: got %v", err)
+	}
+
+	config.Items[0].Metadata.Types = MetaTypes{{Name: "Song", Id: 1}, {Name: "Jingle", Id: 7}}
+	if err := config.Validate(); err != nil {
+		t.Errorf("channel types: got %v", err)
+	}
+
+	// sink types apply to the sink only
+	config.Items[0].Metadata.Sinks = []MetadataSink{{Name: "sink", TargetUrl: "http://localhost", Types: MetaTypes{{Name: "Song", Id: 1}}}}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "sink") {
+		t.Errorf("unknown sink type: got %v", err)
+	}
+}
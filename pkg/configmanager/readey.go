@@ -2,16 +2,68 @@ package configmanager
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/nice-pink/audio-tool/pkg/audio/encodings"
 	"github.com/nice-pink/goutil/pkg/log"
 	"github.com/nice-pink/streamey/pkg/miniomanager"
 )
 
+// labels set by readey itself, streams can't overwrite them
+var reservedLabels = []string{"url", "stream"}
+
+// ReadConfig has the default expectations and the streams monitored by readey.
+// Without streams, readey reads the url of its flags.
 type ReadConfig struct {
-	Expectations encodings.Expectations
+	Expectations Expectations
+	Silence      SilenceConfig
 	Minio        miniomanager.MinioConfig
+	Streams      []MonitoredStream
+}
+
+// MonitoredStream is a stream read by readey. Validate is "audio",
+// "privateBit", "latency", "silence", "loudness" or empty. Silence and
+// loudness decode mpeg layer 3 only, AAC streams are not decoded and never get
+// ready. Expectations and silence default to the ones of the config. Labels
+// are added to the metrics of the stream, except the reserved "url" and
+// "stream".
+type MonitoredStream struct {
+	Name           string
+	Url            string
+	Validate       string
+	Expectations   *Expectations
+	Silence        *SilenceConfig
+	OutputFilepath string
+	Labels         map[string]string
+}
+
+// Expectations are the encoding expectations of audio validation and the
+// loudness range of loudness validation.
+type Expectations struct {
+	encodings.Expectations
+	Loudness LoudnessExpectations
+}
+
+// LoudnessExpectations is the range of the short-term loudness in LUFS and the
+// maximum true-peak in dBTP. A stream out of range for DurationSec raises an
+// alert. Zero values are not checked. Only mpeg layer 3 streams are measured.
+type LoudnessExpectations struct {
+	MinLufs       float64
+	MaxLufs       float64
+	MaxTruePeakDb float64
+	DurationSec   float64
+}
+
+// SilenceConfig defines silence of the silence validation. A stream is silent
+// if the rms level of every window of WindowSec stays below ThresholdDb
+// (dBFS) for DurationSec. Zero values use the defaults of package level. Only
+// mpeg layer 3 streams are decoded, not AAC.
+type SilenceConfig struct {
+	ThresholdDb float64
+	DurationSec float64
+	WindowSec   float64
 }
 
 func GetReadConfig(configFile string) ReadConfig {
@@ -27,5 +79,74 @@ func GetReadConfig(configFile string) ReadConfig {
 		log.Error("No valid expectations config.")
 		panic(err)
 	}
+	if err := config.Validate(); err != nil {
+		log.Error("No valid read config.")
+		panic(err)
+	}
 	return config
 }
+
+func (c ReadConfig) Validate() error {
+	names := map[string]bool{}
+	for i, stream := range c.GetStreams() {
+		if stream.Url == "" {
+			return fmt.Errorf("stream %d: url missing", i)
+		}
+		if names[stream.Name] {
+			return fmt.Errorf("stream %s: duplicate name", stream.Name)
+		}
+		names[stream.Name] = true
+		for _, label := range reservedLabels {
+			if _, ok := stream.Labels[label]; ok {
+				return fmt.Errorf("stream %s: label %s is reserved", stream.Name, label)
+			}
+		}
+		if stream.Silence.ThresholdDb > 0 || stream.Silence.DurationSec < 0 || stream.Silence.WindowSec < 0 {
+			return fmt.Errorf("stream %s: invalid silence config", stream.Name)
+		}
+		loudness := stream.Expectations.Loudness
+		if loudness.MinLufs != 0 && loudness.MaxLufs != 0 && loudness.MinLufs > loudness.MaxLufs {
+			return fmt.Errorf("stream %s: loudness min above max", stream.Name)
+		}
+		switch strings.ToLower(stream.Validate) {
+		case "", "audio", "privatebit", "latency", "silence", "loudness":
+		default:
+			return fmt.Errorf("stream %s: unknown validation %s", stream.Name, stream.Validate)
+		}
+	}
+	return nil
+}
+
+// GetStreams returns the streams with defaults. The name defaults to the url.
+// All streams get the same label names, missing labels are empty, as metrics
+// of the same name must have the same labels.
+func (c ReadConfig) GetStreams() []MonitoredStream {
+	labelNames := map[string]bool{}
+	for _, stream := range c.Streams {
+		for name := range stream.Labels {
+			labelNames[name] = true
+		}
+	}
+
+	streams := []MonitoredStream{}
+	for _, stream := range c.Streams {
+		if stream.Name == "" {
+			stream.Name = stream.Url
+		}
+		if stream.Expectations == nil {
+			expectations := c.Expectations
+			stream.Expectations = &expectations
+		}
+		if stream.Silence == nil {
+			silence := c.Silence
+			stream.Silence = &silence
+		}
+		labels := map[string]string{}
+		for name := range labelNames {
+			labels[name] = stream.Labels[name]
+		}
+		stream.Labels = labels
+		streams = append(streams, stream)
+	}
+	return streams
+}
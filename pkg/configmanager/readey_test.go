@@ -0,0 +1,74 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nice-pink/audio-tool/pkg/audio/encodings"
+)
+
+func TestReadConfigStreams(t *testing.T) {
+	config := ReadConfig{
+		Expectations: Expectations{Expectations: encodings.Expectations{Encoding: encodings.Encoding{Bitrate: 192000}}},
+		Silence:      SilenceConfig{ThresholdDb: -60},
+		Streams: []MonitoredStream{
+			{Url: "https://example.com/a.mp3", Validate: "audio", Labels: map[string]string{"mount": "a"}},
+			{Name: "b", Url: "https://example.com/b.mp3", Validate: "silence", Silence: &SilenceConfig{DurationSec: 30}, Labels: map[string]string{"region": "eu"}},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	streams := config.GetStreams()
+	if streams[0].Name != "https://example.com/a.mp3" || streams[1].Name != "b" {
+		t.Errorf("names: got %s, %s", streams[0].Name, streams[1].Name)
+	}
+	if streams[0].Expectations == nil || streams[0].Expectations.Encoding.Bitrate != 192000 {
+		t.Errorf("default expectations: got %v", streams[0].Expectations)
+	}
+	if streams[0].Silence.ThresholdDb != -60 || streams[1].Silence.ThresholdDb != 0 || streams[1].Silence.DurationSec != 30 {
+		t.Errorf("silence: got %v, %v", streams[0].Silence, streams[1].Silence)
+	}
+	// same label names for all streams
+	if len(streams[0].Labels) != 2 || streams[0].Labels["region"] != "" || streams[1].Labels["mount"] != "" || streams[1].Labels["region"] != "eu" {
+		t.Errorf("labels: got %v, %v", streams[0].Labels, streams[1].Labels)
+	}
+
+	config.Streams[1].Name = "https://example.com/a.mp3"
+	if err := config.Validate(); err == nil {
+		t.Error("duplicate name accepted")
+	}
+	config.Streams[1] = MonitoredStream{Url: "https://example.com/b.mp3", Silence: &SilenceConfig{ThresholdDb: 6}}
+	if err := config.Validate(); err == nil {
+		t.Error("positive silence threshold accepted")
+	}
+	config.Streams[1] = MonitoredStream{Url: "https://example.com/b.mp3", Validate: "loudness", Expectations: &Expectations{Loudness: LoudnessExpectations{MinLufs: -14, MaxLufs: -18}}}
+	if err := config.Validate(); err == nil {
+		t.Error("inverted loudness range accepted")
+	}
+	config.Streams[1] = MonitoredStream{Url: "https://example.com/b.mp3", Validate: "video"}
+	if err := config.Validate(); err == nil {
+		t.Error("unknown validation accepted")
+	}
+}
+
+func TestReadConfigLoudness(t *testing.T) {
+	data := `{"Expectations": {"Encoding": {"Bitrate": 128000}, "Loudness": {"MinLufs": -18, "MaxLufs": -14}}}`
+	var config ReadConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Expectations.Encoding.Bitrate != 128000 || config.Expectations.Loudness.MinLufs != -18 || config.Expectations.Loudness.MaxLufs != -14 {
+		t.Errorf("expectations: got %+v", config.Expectations)
+	}
+}
+
+func TestReadConfigReservedLabels(t *testing.T) {
+	for _, label := range []string{"url", "stream", "station"} {
+		config := ReadConfig{Streams: []MonitoredStream{{Url: "http://localhost", Labels: map[string]string{label: "x"}}}}
+		err := config.Validate()
+		if reserved := label != "station"; (err != nil) != reserved {
+			t.Errorf("label %s: got %v", label, err)
+		}
+	}
+}
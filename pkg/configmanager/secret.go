@@ -0,0 +1,55 @@
+package configmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	AuthHmac   string = "hmac"
+	AuthOAuth2 string = "oauth2"
+)
+
+// GetSecret returns value, the content of file "@file" or the environment
+// variable "env:NAME".
+func GetSecret(value string) (string, error) {
+	if file, ok := strings.CutPrefix(value, "@"); ok {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if name, ok := strings.CutPrefix(value, "env:"); ok {
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", name)
+		}
+		return secret, nil
+	}
+	return value, nil
+}
+
+// Validate checks auth type, required fields and that secrets can be read.
+func (a AuthConfig) Validate() error {
+	switch strings.ToLower(a.Type) {
+	case "":
+		return nil
+	case AuthHmac:
+		if a.Secret == "" {
+			return errors.New("hmac secret missing")
+		}
+		_, err := GetSecret(a.Secret)
+		return err
+	case AuthOAuth2:
+		if a.TokenUrl == "" || a.ClientId == "" || a.ClientSecret == "" {
+			return errors.New("oauth2 token url, client id or client secret missing")
+		}
+		_, err := GetSecret(a.ClientSecret)
+		return err
+	default:
+		return fmt.Errorf("unknown auth type %s", a.Type)
+	}
+}
@@ -2,10 +2,29 @@ package configmanager
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/miniomanager"
+	"github.com/nice-pink/streamey/pkg/schema"
+)
+
+const (
+	DEFAULT_SINK     string = "default"
+	DEFAULT_RT       string = "{{ .Artist }} - {{ .Title }}"
+	SinkTypeHttp     string = "http"
+	SinkTypeUecp     string = "uecp"
+	UECP_CONTENTTYPE string = "text/plain"
+	// undelivered events kept per sink
+	DEFAULT_SPOOL_MAX int = 1000
+	// folder of the sequence files of channels without sequence file
+	DEFAULT_SEQUENCE_FOLDER string = "state"
 )
 
 type StreamFormat int
@@ -36,8 +55,12 @@ type StreamsConfig struct {
 type StreamConfig struct {
 	ChannelName string
 	Audio       AudioConfig
+	Buffer      BufferConfig
 	Metadata    MetadataConfig
 	Playlist    Playlist
+	Marker      MarkerConfig
+	Faults      FaultConfig
+	AsRun       AsRunConfig
 }
 
 type AudioConfig struct {
@@ -47,15 +70,268 @@ type AudioConfig struct {
 	Format     string
 }
 
+// BufferConfig controls pacing after every (re)connect: BurstSec of audio are
+// sent at once, then the rate ramps from RampUpFactor to 1 in RampUpSec.
+// connection.StreamBuffer of audio-tool paces by bitrate only, so channels
+// with buffer settings are paced by streamey.
+type BufferConfig struct {
+	BurstSec      float64
+	RampUpSec     float64
+	RampUpFactor  float64
+	RampUpProfile string
+}
+
+// Enabled returns true if a burst or ramp up is configured.
+func (c BufferConfig) Enabled() bool {
+	return c.BurstSec > 0 || (c.RampUpSec > 0 && c.RampUpFactor > 0)
+}
+
+// MetadataConfig has the sinks of a channel. TargetUrl, Template and Headers
+// define a single sink named "default" as before Sinks. Delivery settings are
+// defaults for all sinks. Retries is nil for the default, 0 disables retries. SequenceFile keeps the play sequence over restarts,
+// by default in DEFAULT_SEQUENCE_FOLDER by channel name.
+// Types maps item types to ids, sinks may define their own. CaptureFile
+// records all sent requests as jsonl for replay.
 type MetadataConfig struct {
-	TargetUrl string
-	Template  string
-	Headers   map[string]string
+	TargetUrl    string
+	Template     string
+	Headers      map[string]string
+	SequenceFile string
+	CaptureFile  string
+	Types        MetaTypes
+	OffsetSec    float64
+	TimeoutSec   float64
+	Retries      *int
+	BackoffSec   float64
+	SpoolFolder  string
+	SpoolMax     int
+	Validation   ValidationConfig
+	Sinks        []MetadataSink
+}
+
+// MetadataSink is a http endpoint or, with Type "uecp", a RDS encoder. For
+// RDS the template renders the radiotext.
+type MetadataSink struct {
+	Name        string
+	Type        string
+	TargetUrl   string
+	Method      string
+	Template    string
+	ContentType string
+	Headers     map[string]string
+	TimeoutSec  float64
+	Retries     *int
+	BackoffSec  float64
+	SpoolFolder string
+	SpoolMax    int
+	Types       MetaTypes
+	Auth        AuthConfig
+	Validation  ValidationConfig
+	Uecp        UecpConfig
+}
+
+// ValidationConfig checks rendered json and xml bodies before sending.
+// JsonSchema is a schema file, RequiredElements are xml element paths like
+// "event/artist".
+type ValidationConfig struct {
+	Disabled         bool
+	JsonSchema       string
+	RequiredElements []string
+}
+
+// Validate reads the json schema and compiles its patterns, unsupported
+// keywords are rejected.
+func (c ValidationConfig) Validate() error {
+	if c.Disabled || c.JsonSchema == "" {
+		return nil
+	}
+	if _, err := schema.Read(c.JsonSchema); err != nil {
+		return fmt.Errorf("json schema: %w", err)
+	}
+	return nil
+}
+
+// AuthConfig authenticates requests of a sink. "hmac" signs timestamp and
+// body with Secret, "oauth2" gets bearer tokens with client credentials from
+// TokenUrl. Secrets are given inline, as "@file" or "env:NAME".
+type AuthConfig struct {
+	Type            string
+	Secret          string
+	Header          string
+	TimestampHeader string
+	TokenUrl        string
+	ClientId        string
+	ClientSecret    string
+	Scopes          []string
+}
+
+// UecpConfig is the RDS encoder at Address ("host:port"). Site and Encoder
+// are the UECP addresses, 0 addresses all.
+type UecpConfig struct {
+	Protocol string
+	Address  string
+	Ps       string
+	Site     int
+	Encoder  int
+	Dsn      int
+	Psn      int
+}
+
+// GetTypes returns the meta types of the channel.
+func (c MetadataConfig) GetTypes() MetaTypes {
+	if len(c.Types) == 0 {
+		return DefaultMetaTypes
+	}
+	return c.Types
+}
+
+// GetSinks returns all sinks with defaults applied. contentType is the
+// default content type.
+func (c MetadataConfig) GetSinks(contentType string) []MetadataSink {
+	sinks := []MetadataSink{}
+	if c.TargetUrl != "" {
+		sinks = append(sinks, MetadataSink{Name: DEFAULT_SINK, TargetUrl: c.TargetUrl, Template: c.Template, Headers: c.Headers})
+	}
+	sinks = append(sinks, c.Sinks...)
+
+	for i := range sinks {
+		sink := &sinks[i]
+		sink.Type = strings.ToLower(sink.Type)
+		if sink.Type == "" {
+			sink.Type = SinkTypeHttp
+		}
+		if sink.Type == SinkTypeUecp {
+			if sink.Template == "" {
+				sink.Template = DEFAULT_RT
+			}
+			if sink.ContentType == "" {
+				sink.ContentType = UECP_CONTENTTYPE
+			}
+			sink.Uecp.Protocol = strings.ToLower(sink.Uecp.Protocol)
+			if sink.Uecp.Protocol == "" {
+				sink.Uecp.Protocol = "tcp"
+			}
+			// only the current text is of interest on replay
+			if sink.SpoolMax == 0 {
+				sink.SpoolMax = 1
+			}
+		}
+		if sink.Method == "" {
+			sink.Method = "POST"
+		}
+		if sink.ContentType == "" {
+			sink.ContentType = contentType
+		}
+		if sink.TimeoutSec == 0 {
+			sink.TimeoutSec = c.TimeoutSec
+		}
+		if sink.Retries == nil {
+			sink.Retries = c.Retries
+		}
+		if sink.BackoffSec == 0 {
+			sink.BackoffSec = c.BackoffSec
+		}
+		if sink.SpoolFolder == "" && c.SpoolFolder != "" {
+			sink.SpoolFolder = filepath.Join(c.SpoolFolder, sink.Name)
+		}
+		if sink.SpoolMax == 0 {
+			sink.SpoolMax = c.SpoolMax
+		}
+		if sink.SpoolMax == 0 {
+			sink.SpoolMax = DEFAULT_SPOOL_MAX
+		}
+		if len(sink.Types) == 0 {
+			sink.Types = c.GetTypes()
+		}
+		if !sink.Validation.Disabled && sink.Validation.JsonSchema == "" && len(sink.Validation.RequiredElements) == 0 {
+			sink.Validation = c.Validation
+		}
+	}
+	return sinks
+}
+
+// GetSequenceFile returns the sequence file of channel.
+func (c MetadataConfig) GetSequenceFile(channelName string) string {
+	if c.SequenceFile != "" {
+		return c.SequenceFile
+	}
+	return filepath.Join(DEFAULT_SEQUENCE_FOLDER, channelName+".seq")
+}
+
+type MarkerConfig struct {
+	Enabled     bool
+	IntervalSec float64
+}
+
+type FaultConfig struct {
+	Enabled     bool
+	IntervalSec float64
+	Faults      []Fault
+}
+
+type Fault struct {
+	Type        string
+	DurationSec float64
+	Factor      float64
+	Frames      int
+}
+
+const (
+	FaultStall    string = "stall"
+	FaultBurst    string = "burst"
+	FaultThrottle string = "throttle"
+	FaultDrop     string = "drop"
+	FaultTruncate string = "truncate"
+	FaultCorrupt  string = "corrupt"
+)
+
+// Validate checks the type of every fault and its values. Bursts need a rate
+// factor above 1, throttles between 0 and 1.
+func (c FaultConfig) Validate() error {
+	if c.IntervalSec < 0 {
+		return fmt.Errorf("fault interval must be >= 0")
+	}
+	for i, fault := range c.Faults {
+		if fault.DurationSec < 0 || fault.Frames < 0 {
+			return fmt.Errorf("fault %d: duration and frames must be >= 0", i)
+		}
+		switch strings.ToLower(fault.Type) {
+		case FaultStall, FaultDrop, FaultTruncate, FaultCorrupt:
+		case FaultBurst:
+			if fault.Factor <= 1 {
+				return fmt.Errorf("fault %d: burst factor must be > 1", i)
+			}
+		case FaultThrottle:
+			if fault.Factor <= 0 || fault.Factor >= 1 {
+				return fmt.Errorf("fault %d: throttle factor must be in (0, 1)", i)
+			}
+		default:
+			return fmt.Errorf("fault %d: unknown type %s", i, fault.Type)
+		}
+	}
+	return nil
+}
+
+type AsRunConfig struct {
+	Enabled   bool
+	Folder    string
+	Format    string
+	RotateSec float64
+	Upload    AsRunUpload
+}
+
+type AsRunUpload struct {
+	Enabled     bool
+	Bucket      string
+	Folder      string
+	DeleteLocal bool
+	Minio       miniomanager.MinioConfig
 }
 
 type Playlist struct {
 	ContentType string
 	Items       []PlaylistItem
+	Fallback    PlaylistItem
 }
 
 type PlaylistItem struct {
@@ -65,20 +341,158 @@ type PlaylistItem struct {
 	Album    string
 	Filepath string
 	Duration float64
+	Custom   map[string]string
 }
 
 func GetStreamConfig(filepath string) StreamsConfig {
-	data, err := os.ReadFile(filepath)
+	config, err := ReadStreamConfig(filepath)
 	if err != nil {
-		log.Error("Config file does not exist.")
+		log.Error("No valid streams config.")
 		panic(err)
 	}
+	return config
+}
+
+// ReadStreamConfig reads and validates the streams config.
+func ReadStreamConfig(filepath string) (StreamsConfig, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return StreamsConfig{}, err
+	}
 
 	var config StreamsConfig
 	err = json.Unmarshal(data, &config)
 	if err != nil {
-		log.Error("No valid streams config.")
-		panic(err)
+		return StreamsConfig{}, err
 	}
-	return config
+	return config, config.Validate()
+}
+
+func (c StreamsConfig) Validate() error {
+	names := map[string]bool{}
+	sequenceFiles := map[string]string{}
+	for i, item := range c.Items {
+		if item.ChannelName == "" {
+			return fmt.Errorf("item %d: channel name missing", i)
+		}
+		if names[item.ChannelName] {
+			return fmt.Errorf("channel %s: duplicate channel name", item.ChannelName)
+		}
+		names[item.ChannelName] = true
+		sequenceFile := filepath.Clean(item.Metadata.GetSequenceFile(item.ChannelName))
+		if other, ok := sequenceFiles[sequenceFile]; ok {
+			return fmt.Errorf("channel %s: sequence file %s is used by channel %s", item.ChannelName, sequenceFile, other)
+		}
+		sequenceFiles[sequenceFile] = item.ChannelName
+
+		if item.Audio.TargetUrl == "" {
+			return fmt.Errorf("channel %s: audio target url missing", item.ChannelName)
+		}
+		if item.Audio.Bitrate <= 0 {
+			return fmt.Errorf("channel %s: audio bitrate must be > 0", item.ChannelName)
+		}
+		if len(item.Playlist.Items) == 0 {
+			return fmt.Errorf("channel %s: playlist is empty", item.ChannelName)
+		}
+		typed := item.Playlist.Items
+		if item.Playlist.Fallback.Type != "" {
+			typed = append(typed[:len(typed):len(typed)], item.Playlist.Fallback)
+		}
+		if err := validateTypes(item.Metadata.GetTypes(), typed); err != nil {
+			return fmt.Errorf("channel %s: %w", item.ChannelName, err)
+		}
+		sinks := map[string]bool{}
+		for _, sink := range item.Metadata.GetSinks(item.Playlist.ContentType) {
+			if err := validateTypes(sink.Types, typed); err != nil {
+				return fmt.Errorf("channel %s: metadata sink %s: %w", item.ChannelName, sink.Name, err)
+			}
+			if sink.Name == "" {
+				return fmt.Errorf("channel %s: metadata sink name missing", item.ChannelName)
+			}
+			if err := sink.Auth.Validate(); err != nil {
+				return fmt.Errorf("channel %s: metadata sink %s: %w", item.ChannelName, sink.Name, err)
+			}
+			if err := sink.Validation.Validate(); err != nil {
+				return fmt.Errorf("channel %s: metadata sink %s: %w", item.ChannelName, sink.Name, err)
+			}
+			switch sink.Type {
+			case SinkTypeHttp:
+				if sink.TargetUrl == "" {
+					return fmt.Errorf("channel %s: metadata sink %s: target url missing", item.ChannelName, sink.Name)
+				}
+			case SinkTypeUecp:
+				if sink.Uecp.Address == "" {
+					return fmt.Errorf("channel %s: metadata sink %s: uecp address missing", item.ChannelName, sink.Name)
+				}
+				if sink.Uecp.Protocol != "tcp" && sink.Uecp.Protocol != "udp" {
+					return fmt.Errorf("channel %s: metadata sink %s: unknown uecp protocol %s", item.ChannelName, sink.Name, sink.Uecp.Protocol)
+				}
+			default:
+				return fmt.Errorf("channel %s: metadata sink %s: unknown type %s", item.ChannelName, sink.Name, sink.Type)
+			}
+			if sinks[sink.Name] {
+				return fmt.Errorf("channel %s: duplicate metadata sink %s", item.ChannelName, sink.Name)
+			}
+			sinks[sink.Name] = true
+		}
+		if item.Buffer.BurstSec < 0 || item.Buffer.RampUpSec < 0 || item.Buffer.RampUpFactor < 0 {
+			return fmt.Errorf("channel %s: buffer values must be >= 0", item.ChannelName)
+		}
+		switch strings.ToLower(item.Buffer.RampUpProfile) {
+		case "", "linear", "step":
+		default:
+			return fmt.Errorf("channel %s: unknown ramp up profile %s", item.ChannelName, item.Buffer.RampUpProfile)
+		}
+		if err := item.Faults.Validate(); err != nil {
+			return fmt.Errorf("channel %s: %w", item.ChannelName, err)
+		}
+		if item.AsRun.Enabled && item.AsRun.Folder == "" {
+			return fmt.Errorf("channel %s: as-run folder missing", item.ChannelName)
+		}
+		switch strings.ToLower(item.AsRun.Format) {
+		case "", "jsonl", "csv":
+		default:
+			return fmt.Errorf("channel %s: unknown as-run format %s", item.ChannelName, item.AsRun.Format)
+		}
+	}
+	return nil
+}
+
+// WatchStreamConfig calls apply with the new config, whenever the config file
+// changes or SIGHUP is received. Invalid configs are rejected. Blocks forever.
+func WatchStreamConfig(filepath string, interval time.Duration, apply func(config StreamsConfig)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	modTime := getModTime(filepath)
+	for {
+		select {
+		case <-hup:
+			log.Info("SIGHUP: reload config", filepath)
+		case <-ticker.C:
+			current := getModTime(filepath)
+			if current.Equal(modTime) {
+				continue
+			}
+			modTime = current
+			log.Info("Config changed: reload config", filepath)
+		}
+
+		config, err := ReadStreamConfig(filepath)
+		if err != nil {
+			log.Err(err, "Reject invalid config, keep running state.")
+			continue
+		}
+		apply(config)
+	}
+}
+
+func getModTime(filepath string) time.Time {
+	info, err := os.Stat(filepath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
 }
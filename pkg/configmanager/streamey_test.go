@@ -0,0 +1,109 @@
+package configmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// validConfig returns a config of one channel, which passes Validate.
+func validConfig() StreamsConfig {
+	return StreamsConfig{Items: []StreamConfig{{
+		ChannelName: "test",
+		Audio:       AudioConfig{TargetUrl: "http://localhost", Bitrate: 128000},
+		Playlist:    Playlist{Items: []PlaylistItem{{Type: "Song"}}},
+	}}}
+}
+
+func TestValidateFaults(t *testing.T) {
+	tests := []struct {
+		fault Fault
+		valid bool
+	}{
+		{Fault{Type: "stall", DurationSec: 2}, true},
+		{Fault{Type: "Burst", Factor: 2}, true},
+		{Fault{Type: "throttle", Factor: 0.5}, true},
+		{Fault{Type: "burst", Factor: 0}, false},
+		{Fault{Type: "burst", Factor: 0.5}, false},
+		{Fault{Type: "throttle", Factor: 2}, false},
+		{Fault{Type: "throttle"}, false},
+		{Fault{Type: "stall", DurationSec: -1}, false},
+		{Fault{Type: "explode"}, false},
+	}
+	for _, test := range tests {
+		config := validConfig()
+		config.Items[0].Faults = FaultConfig{Enabled: true, Faults: []Fault{test.fault}}
+		if err := config.Validate(); (err == nil) != test.valid {
+			t.Errorf("%+v: got %v", test.fault, err)
+		}
+	}
+}
+
+func TestSinkSpoolMax(t *testing.T) {
+	c := MetadataConfig{TargetUrl: "http://localhost", Sinks: []MetadataSink{{Name: "unbounded", SpoolMax: -1}}}
+	sinks := c.GetSinks("")
+	if sinks[0].SpoolMax != DEFAULT_SPOOL_MAX {
+		t.Errorf("default spool max: got %d, want %d", sinks[0].SpoolMax, DEFAULT_SPOOL_MAX)
+	}
+	if sinks[1].SpoolMax != -1 {
+		t.Errorf("spool max: got %d, want -1", sinks[1].SpoolMax)
+	}
+}
+
+func TestSinkRetries(t *testing.T) {
+	retries, none := 5, 0
+	c := MetadataConfig{TargetUrl: "http://localhost", Retries: &retries, Sinks: []MetadataSink{{Name: "none", Retries: &none}}}
+	sinks := c.GetSinks("")
+	if sinks[0].Retries == nil || *sinks[0].Retries != 5 {
+		t.Errorf("default sink: got %v, want 5 retries", sinks[0].Retries)
+	}
+	if sinks[1].Retries == nil || *sinks[1].Retries != 0 {
+		t.Errorf("sink without retries: got %v, want 0", sinks[1].Retries)
+	}
+}
+
+func TestValidateSequenceFiles(t *testing.T) {
+	c := validConfig()
+	second := c.Items[0]
+	second.ChannelName = "other"
+	c.Items = append(c.Items, second)
+	if err := c.Validate(); err != nil {
+		t.Errorf("default sequence files: %v", err)
+	}
+	if file := c.Items[1].Metadata.GetSequenceFile("other"); file != "state/other.seq" {
+		t.Errorf("default sequence file: got %s", file)
+	}
+
+	c.Items[0].Metadata.SequenceFile = "state/other.seq"
+	if err := c.Validate(); err == nil {
+		t.Error("shared sequence file is valid")
+	}
+}
+
+func TestValidateJsonSchema(t *testing.T) {
+	folder := t.TempDir()
+	valid := filepath.Join(folder, "schema.json")
+	os.WriteFile(valid, []byte(`{"type": "object"}`), 0644)
+	broken := filepath.Join(folder, "broken.json")
+	os.WriteFile(broken, []byte(`{"type": `), 0644)
+	unsupported := filepath.Join(folder, "unsupported.json")
+	os.WriteFile(unsupported, []byte(`{"anyOf": [{"type": "string"}]}`), 0644)
+	pattern := filepath.Join(folder, "pattern.json")
+	os.WriteFile(pattern, []byte(`{"properties": {"isrc": {"pattern": "("}}}`), 0644)
+
+	tests := map[string]bool{
+		valid:                                 true,
+		broken:                                false,
+		unsupported:                           false,
+		pattern:                               false,
+		filepath.Join(folder, "missing.json"): false,
+	}
+	for schema, ok := range tests {
+		c := validConfig()
+		c.Items[0].Metadata.TargetUrl = "http://localhost"
+		c.Items[0].Metadata.Validation.JsonSchema = schema
+		if err := c.Validate(); (err == nil) != ok {
+			t.Errorf("%s: got %v", filepath.Base(schema), err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package latency
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/marker"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+	"github.com/nice-pink/streamey/pkg/mp3"
+	streameyutil "github.com/nice-pink/streamey/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// allowed clock difference between sender and receiver
+	CLOCK_SKEW     time.Duration = 5 * time.Second
+	REPORT_COUNT   int           = 10
+	MARKER_TIMEOUT time.Duration = 60 * time.Second
+)
+
+// Meter detects the markers set by streamey and measures the latency between
+// sending and receiving them. Sender and receiver clocks must be in sync.
+type Meter struct {
+	decoder   *marker.Decoder
+	histogram prometheus.Histogram
+	latencies []float64
+
+	mu         sync.Mutex
+	lastMarker time.Time
+}
+
+func NewMeter(metrics util.MetricsControl) *Meter {
+	histogram := metricmanager.NewHistogram(metrics, "marker_latency_seconds", "Latency between sending and receiving a marker.", prometheus.ExponentialBuckets(0.25, 2, 10))
+	return &Meter{decoder: marker.NewDecoder(), histogram: histogram}
+}
+
+func (m *Meter) Frame(frame []byte, header mp3.Header, received time.Time) {
+	m.mu.Lock()
+	if m.lastMarker.IsZero() {
+		// start waiting for markers
+		m.lastMarker = received
+	}
+	m.mu.Unlock()
+
+	mark, ok := m.decoder.Push(header.Copyright, received)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	m.lastMarker = received
+	m.mu.Unlock()
+
+	sent := marker.TimeFromId(mark.Id, mark.Received.Add(CLOCK_SKEW))
+	latency := mark.Received.Sub(sent)
+	log.Info("marker", mark.Id, "sent", sent.UTC().Format(time.RFC3339Nano), "latency", latency)
+	m.histogram.Observe(latency.Seconds())
+
+	m.latencies = append(m.latencies, latency.Seconds())
+	if len(m.latencies) >= REPORT_COUNT {
+		m.report()
+		m.latencies = m.latencies[:0]
+	}
+}
+
+func (m *Meter) Reset() {
+	m.decoder.Reset()
+}
+
+// Check fails, if no marker was detected for a while.
+func (m *Meter) Check() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.lastMarker.IsZero() && time.Since(m.lastMarker) > MARKER_TIMEOUT {
+		return errors.New("no marker since " + m.lastMarker.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (m *Meter) report() {
+	slices.Sort(m.latencies)
+	log.Info("latency of last", len(m.latencies), "markers: min", m.latencies[0],
+		"p50", streameyutil.Percentile(m.latencies, 50),
+		"p90", streameyutil.Percentile(m.latencies, 90),
+		"max", m.latencies[len(m.latencies)-1],
+		"invalid markers", m.decoder.Invalid)
+}
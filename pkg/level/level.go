@@ -0,0 +1,142 @@
+package level
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	THRESHOLD_DB     float64       = -50
+	SILENCE_DURATION time.Duration = 10 * time.Second
+	WINDOW           time.Duration = time.Second
+	// level of digital silence
+	MIN_DB float64 = -120
+)
+
+// Detector measures rms and peak level of decoded samples per window and
+// raises a silence event if the level stays below the threshold. Received
+// frames are decoded by mp3.PcmHandler.
+type Detector struct {
+	threshold float64
+	duration  time.Duration
+	window    time.Duration
+
+	// current window
+	sum     float64
+	peak    float64
+	samples int
+
+	rms             prometheus.Gauge
+	peakGauge       prometheus.Gauge
+	silenceDuration prometheus.Gauge
+	events          prometheus.Counter
+
+	mu      sync.Mutex
+	silent  time.Duration
+	silence bool
+}
+
+func NewDetector(config configmanager.SilenceConfig, metrics util.MetricsControl) *Detector {
+	d := &Detector{
+		threshold: THRESHOLD_DB,
+		duration:  SILENCE_DURATION,
+		window:    WINDOW,
+	}
+	if config.ThresholdDb != 0 {
+		d.threshold = config.ThresholdDb
+	}
+	if config.DurationSec > 0 {
+		d.duration = time.Duration(config.DurationSec * float64(time.Second))
+	}
+	if config.WindowSec > 0 {
+		d.window = time.Duration(config.WindowSec * float64(time.Second))
+	}
+
+	d.rms = metricmanager.NewGauge(metrics, "level_rms_dbfs", "RMS level of the last window in dBFS.")
+	d.peakGauge = metricmanager.NewGauge(metrics, "level_peak_dbfs", "Peak level of the last window in dBFS.")
+	d.silenceDuration = metricmanager.NewGauge(metrics, "silence_duration_seconds", "Duration of the current silence.")
+	d.events = metricmanager.NewCounter(metrics, "silence_events_total", "Silences longer than the silence duration.")
+	return d
+}
+
+// Push adds decoded samples by channel.
+func (d *Detector) Push(pcm [][]float32, sampleRate int) {
+	if len(pcm) == 0 {
+		return
+	}
+	windowSize := int(d.window.Seconds() * float64(sampleRate))
+	for i := range pcm[0] {
+		for _, channel := range pcm {
+			sample := float64(channel[i])
+			d.sum += sample * sample
+			d.peak = math.Max(d.peak, math.Abs(sample))
+		}
+		d.samples++
+		if d.samples >= windowSize {
+			d.measure(len(pcm))
+		}
+	}
+}
+
+func (d *Detector) Reset() {
+	d.sum, d.peak, d.samples = 0, 0, 0
+}
+
+// Check fails during a silence event.
+func (d *Detector) Check() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.silence {
+		return errors.New("silent for " + d.silent.Round(time.Second).String())
+	}
+	return nil
+}
+
+// Silent returns the duration of the current silence.
+func (d *Detector) Silent() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.silent
+}
+
+func (d *Detector) measure(channels int) {
+	rms := Dbfs(math.Sqrt(d.sum / float64(d.samples*channels)))
+	peak := Dbfs(d.peak)
+	d.sum, d.peak, d.samples = 0, 0, 0
+	d.rms.Set(rms)
+	d.peakGauge.Set(peak)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rms >= d.threshold {
+		if d.silence {
+			log.Info("silence ended after", d.silent.Round(time.Second), "level", rms, "dBFS")
+		}
+		d.silent, d.silence = 0, false
+		d.silenceDuration.Set(0)
+		return
+	}
+	d.silent += d.window
+	d.silenceDuration.Set(d.silent.Seconds())
+	if !d.silence && d.silent >= d.duration {
+		d.silence = true
+		d.events.Inc()
+		log.Warn("silence for", d.silent.Round(time.Second), "level", rms, "dBFS, threshold", d.threshold, "dBFS")
+	}
+}
+
+// Dbfs returns the level of amplitude in dBFS, at least MIN_DB.
+func Dbfs(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return MIN_DB
+	}
+	return math.Max(MIN_DB, 20*math.Log10(amplitude))
+}
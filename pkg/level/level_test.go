@@ -0,0 +1,56 @@
+package level
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/mp3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDetector(t *testing.T) {
+	d := NewDetector(configmanager.SilenceConfig{DurationSec: 2, WindowSec: 0.5}, util.MetricsControl{})
+
+	// sine of amplitude 0.5, -9 dBFS rms
+	tone := make([]float32, 8000)
+	for i := range tone {
+		tone[i] = float32(0.5 * math.Sin(2*math.Pi*440*float64(i)/8000))
+	}
+	d.Push([][]float32{tone, tone}, 8000)
+	if rms := testutil.ToFloat64(d.rms); math.Abs(rms+9.03) > 0.1 {
+		t.Errorf("rms: got %f", rms)
+	}
+	if peak := testutil.ToFloat64(d.peakGauge); math.Abs(peak+6.02) > 0.1 {
+		t.Errorf("peak: got %f", peak)
+	}
+
+	// decoded silence
+	handler := mp3.NewPcmHandler(d)
+	data, err := mp3.SilentFrames(64000, 44100, true, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, frame := range mp3.Frames(data) {
+		handler.Frame(data[frame.Offset:frame.End()], frame.Header, time.Now())
+		if i == 40 && d.Check() != nil {
+			t.Errorf("silent after 1s")
+		}
+	}
+	if d.Check() == nil || d.Silent() < 2*time.Second {
+		t.Errorf("no silence after %v", d.Silent())
+	}
+	if events := testutil.ToFloat64(d.events); events != 1 {
+		t.Errorf("events: got %f", events)
+	}
+	if rms := testutil.ToFloat64(d.rms); rms != MIN_DB {
+		t.Errorf("silent rms: got %f", rms)
+	}
+
+	d.Push([][]float32{tone}, 8000)
+	if d.Check() != nil || testutil.ToFloat64(d.silenceDuration) != 0 {
+		t.Errorf("silence did not end: %v", d.Check())
+	}
+}
@@ -0,0 +1,442 @@
+package load
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/network"
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/goutil/pkg/log"
+	streameyutil "github.com/nice-pink/streamey/pkg/util"
+)
+
+const (
+	LifetimeFixed       string = "fixed"
+	LifetimeUniform     string = "uniform"
+	LifetimeExponential string = "exponential"
+
+	FailureConnect  string = "connect"
+	FailureStatus   string = "status"
+	FailureRead     string = "read"
+	FailureValidate string = "validate"
+
+	READ_BUFFER     int           = 32 * 1024
+	REPORT_INTERVAL time.Duration = 10 * time.Second
+	RETRY_DELAY     time.Duration = time.Second
+)
+
+var errTimeout = errors.New("no data within timeout")
+
+// Config of a load test. Lifetimes of 0 keep clients connected until the end.
+type Config struct {
+	Url            string
+	Clients        int
+	Duration       time.Duration
+	RampUp         time.Duration
+	Lifetime       string
+	LifetimeMin    time.Duration
+	LifetimeMean   time.Duration
+	ChurnDelay     time.Duration
+	Timeout        time.Duration
+	ValidateSample float64
+	// NewValidator returns the validator of a sampled client.
+	NewValidator func() network.DataValidator
+}
+
+type Latency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// Summary is the result of a load test. Latencies are in seconds.
+type Summary struct {
+	Url              string         `json:"url"`
+	Clients          int            `json:"clients"`
+	ValidatedClients int            `json:"validatedClients"`
+	DurationSec      float64        `json:"durationSec"`
+	Connects         int            `json:"connects"`
+	Failures         map[string]int `json:"failures"`
+	Bytes            int64          `json:"bytes"`
+	ThroughputBits   float64        `json:"throughputBits"`
+	ConnectLatency   Latency        `json:"connectLatency"`
+}
+
+// Generator opens concurrent listener connections.
+type Generator struct {
+	config  Config
+	client  *http.Client
+	metrics *loadMetrics
+	stop    chan struct{}
+	once    sync.Once
+
+	bytes     atomic.Int64
+	active    atomic.Int64
+	mu        sync.Mutex
+	connects  int
+	failures  map[string]int
+	latencies []float64
+	validated int
+}
+
+func NewGenerator(config Config, metrics util.MetricsControl) *Generator {
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &Generator{
+		config: config,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:           (&net.Dialer{Timeout: config.Timeout}).DialContext,
+				ResponseHeaderTimeout: config.Timeout,
+				// every connect is a new listener
+				DisableKeepAlives: true,
+			},
+		},
+		metrics:  newLoadMetrics(metrics),
+		stop:     make(chan struct{}),
+		failures: map[string]int{FailureConnect: 0, FailureStatus: 0, FailureRead: 0, FailureValidate: 0},
+	}
+}
+
+// Stop ends the test early.
+func (g *Generator) Stop() {
+	g.once.Do(func() { close(g.stop) })
+}
+
+// Run starts all clients within ramp up and blocks until the test duration
+// passed or it is stopped.
+func (g *Generator) Run() Summary {
+	start := time.Now()
+	deadline := start.Add(g.config.Duration)
+	log.Info("Load", g.config.Url, "with", g.config.Clients, "clients for", g.config.Duration)
+
+	done := make(chan struct{})
+	go g.report(done)
+
+	var wg sync.WaitGroup
+	for i := 0; i < g.config.Clients; i++ {
+		delay := time.Duration(0)
+		if g.config.Clients > 1 {
+			delay = g.config.RampUp * time.Duration(i) / time.Duration(g.config.Clients-1)
+		}
+		validate := g.config.NewValidator != nil && rand.Float64() < g.config.ValidateSample
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !g.sleep(delay) {
+				return
+			}
+			g.listener(validate, deadline)
+		}()
+	}
+
+	timer := time.NewTimer(g.config.Duration)
+	select {
+	case <-timer.C:
+		g.Stop()
+	case <-g.stop:
+		timer.Stop()
+	}
+	wg.Wait()
+	close(done)
+	return g.summary(time.Since(start))
+}
+
+// listener connects again and again until deadline, every connection lasts a
+// random lifetime.
+func (g *Generator) listener(validate bool, deadline time.Time) {
+	if validate {
+		g.mu.Lock()
+		g.validated++
+		g.mu.Unlock()
+	}
+	for !g.stopped() {
+		end := deadline
+		if lifetime := g.lifetime(); lifetime > 0 && time.Now().Add(lifetime).Before(deadline) {
+			end = time.Now().Add(lifetime)
+		}
+		if validate {
+			g.validate(end)
+		} else {
+			g.listen(end)
+		}
+		delay := g.config.ChurnDelay
+		if time.Now().Before(end) {
+			// ended early, don't hammer the server
+			delay = max(delay, RETRY_DELAY)
+		}
+		if !g.sleep(delay) {
+			return
+		}
+	}
+}
+
+// listen reads the stream until end.
+func (g *Generator) listen(end time.Time) {
+	ctx, cancel := context.WithDeadline(context.Background(), end)
+	defer cancel()
+	go func() {
+		select {
+		case <-g.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.config.Url, nil)
+	if err != nil {
+		g.fail(FailureConnect, err)
+		return
+	}
+	start := time.Now()
+	resp, err := g.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			g.fail(FailureConnect, err)
+		}
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		g.fail(FailureStatus, errors.New("status code "+strconv.Itoa(resp.StatusCode)))
+		return
+	}
+	g.connected(time.Since(start))
+	defer g.disconnected()
+
+	// cancel the request if the stream stalls
+	var timedOut atomic.Bool
+	watchdog := time.AfterFunc(g.config.Timeout, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+	defer watchdog.Stop()
+
+	buffer := make([]byte, READ_BUFFER)
+	for {
+		n, err := resp.Body.Read(buffer)
+		if n > 0 {
+			watchdog.Reset(g.config.Timeout)
+			g.bytes.Add(int64(n))
+			g.metrics.bytes.Add(float64(n))
+		}
+		if err != nil {
+			if timedOut.Load() {
+				g.fail(FailureRead, errTimeout)
+			} else if ctx.Err() == nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				g.fail(FailureRead, err)
+			}
+			return
+		}
+	}
+}
+
+// validate reads the stream with the validator until end. A validated client
+// is connected with its first data, it has no connect latency.
+func (g *Generator) validate(end time.Time) {
+	// the connection timeout is in seconds
+	timeout := time.Duration(g.config.Timeout.Seconds())
+	connection := network.NewConnection(g.config.Url, "", 80, 0, timeout, network.HttpConnection, util.MetricsControl{})
+	done := make(chan struct{})
+	var closed atomic.Bool
+	go func() {
+		timer := time.NewTimer(time.Until(end))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-g.stop:
+		case <-done:
+			return
+		}
+		closed.Store(true)
+		connection.Close()
+	}()
+
+	validator := &sampledValidator{generator: g, validator: g.config.NewValidator()}
+	err := connection.ReadStream("", false, validator)
+	close(done)
+	if validator.connected {
+		g.disconnected()
+	}
+	if closed.Load() {
+		return
+	}
+	if !validator.connected {
+		if err == nil {
+			err = errTimeout
+		}
+		g.fail(FailureConnect, err)
+		return
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	g.fail(FailureRead, err)
+}
+
+// sampledValidator counts the data of a validated client and its first
+// validation error.
+type sampledValidator struct {
+	generator *Generator
+	validator network.DataValidator
+	connected bool
+	failed    bool
+}
+
+func (v *sampledValidator) Validate(data []byte, failEarly bool) error {
+	if len(data) > 0 {
+		if !v.connected {
+			v.connected = true
+			v.generator.connected(0)
+		}
+		v.generator.bytes.Add(int64(len(data)))
+		v.generator.metrics.bytes.Add(float64(len(data)))
+	}
+	err := v.validator.Validate(data, failEarly)
+	if err != nil && !v.failed {
+		v.failed = true
+		v.generator.fail(FailureValidate, err)
+	}
+	return err
+}
+
+func (g *Generator) connected(latency time.Duration) {
+	g.active.Add(1)
+	g.metrics.clients.Inc()
+	g.metrics.connects.Inc()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.connects++
+	if latency > 0 {
+		g.latencies = append(g.latencies, latency.Seconds())
+		g.metrics.connectLatency.Observe(latency.Seconds())
+	}
+}
+
+func (g *Generator) disconnected() {
+	g.active.Add(-1)
+	g.metrics.clients.Dec()
+}
+
+func (g *Generator) fail(reason string, err error) {
+	log.Err(err, "listener failed:", reason)
+	g.metrics.failures.WithLabelValues(reason).Inc()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failures[reason]++
+}
+
+// lifetime returns a random connection lifetime of the configured distribution.
+func (g *Generator) lifetime() time.Duration {
+	mean := g.config.LifetimeMean
+	switch strings.ToLower(g.config.Lifetime) {
+	case LifetimeUniform:
+		min := g.config.LifetimeMin
+		if mean <= min {
+			return min
+		}
+		// uniform between min and 2*mean-min has the configured mean
+		return min + time.Duration(rand.Int64N(int64(2*(mean-min))))
+	case LifetimeExponential:
+		return time.Duration(rand.ExpFloat64() * float64(mean))
+	default:
+		return mean
+	}
+}
+
+// report updates the throughput every second and logs progress.
+func (g *Generator) report(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := int64(0)
+	lastLog := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			bytes := g.bytes.Load()
+			g.metrics.throughput.Set(float64(bytes-last) * 8)
+			last = bytes
+			if time.Since(lastLog) >= REPORT_INTERVAL {
+				lastLog = time.Now()
+				g.mu.Lock()
+				log.Info("Listeners", g.active.Load(), "connects", g.connects, "failures", g.failures, "bytes", bytes)
+				g.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (g *Generator) summary(duration time.Duration) Summary {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sorted := append([]float64{}, g.latencies...)
+	sort.Float64s(sorted)
+	failures := map[string]int{}
+	for reason, count := range g.failures {
+		failures[reason] = count
+	}
+	bytes := g.bytes.Load()
+	summary := Summary{
+		Url:              g.config.Url,
+		Clients:          g.config.Clients,
+		ValidatedClients: g.validated,
+		DurationSec:      duration.Seconds(),
+		Connects:         g.connects,
+		Failures:         failures,
+		Bytes:            bytes,
+		ConnectLatency: Latency{
+			P50: streameyutil.Percentile(sorted, 50),
+			P90: streameyutil.Percentile(sorted, 90),
+			P99: streameyutil.Percentile(sorted, 99),
+		},
+	}
+	if len(sorted) > 0 {
+		summary.ConnectLatency.Max = sorted[len(sorted)-1]
+	}
+	if duration > 0 {
+		summary.ThroughputBits = float64(bytes) * 8 / duration.Seconds()
+	}
+	return summary
+}
+
+// sleep returns false, if the test was stopped meanwhile.
+func (g *Generator) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return !g.stopped()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-g.stop:
+		return false
+	}
+}
+
+func (g *Generator) stopped() bool {
+	select {
+	case <-g.stop:
+		return true
+	default:
+		return false
+	}
+}
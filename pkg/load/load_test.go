@@ -0,0 +1,198 @@
+package load
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+)
+
+// streamServer streams data until the listener disconnects and records the
+// time of every connect.
+type streamServer struct {
+	mu       sync.Mutex
+	connects []time.Time
+}
+
+func (s *streamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.connects = append(s.connects, time.Now())
+	s.mu.Unlock()
+	data := make([]byte, 1024)
+	for {
+		if _, err := w.Write(data); err != nil {
+			return
+		}
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (s *streamServer) times() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time{}, s.connects...)
+}
+
+func TestRampUp(t *testing.T) {
+	stream := &streamServer{}
+	server := httptest.NewServer(stream)
+	defer server.Close()
+
+	config := Config{Url: server.URL, Clients: 4, Duration: time.Second, RampUp: 600 * time.Millisecond, Timeout: time.Second}
+	summary := NewGenerator(config, util.MetricsControl{}).Run()
+	if summary.Connects != 4 {
+		t.Errorf("connects: got %d, want 4", summary.Connects)
+	}
+	connects := stream.times()
+	if len(connects) != 4 {
+		t.Fatalf("server connects: got %d, want 4", len(connects))
+	}
+	if spread := connects[3].Sub(connects[0]); spread < 500*time.Millisecond {
+		t.Errorf("clients started within %s, want ramp up of 600ms", spread)
+	}
+	if summary.Bytes == 0 {
+		t.Error("no bytes")
+	}
+}
+
+func TestLifetimeChurn(t *testing.T) {
+	stream := &streamServer{}
+	server := httptest.NewServer(stream)
+	defer server.Close()
+
+	config := Config{
+		Url:          server.URL,
+		Clients:      2,
+		Duration:     time.Second,
+		Lifetime:     LifetimeFixed,
+		LifetimeMean: 200 * time.Millisecond,
+		Timeout:      time.Second,
+	}
+	summary := NewGenerator(config, util.MetricsControl{}).Run()
+	if summary.Connects < 6 {
+		t.Errorf("connects: got %d, want reconnects after every lifetime", summary.Connects)
+	}
+	if summary.Connects != len(stream.times()) {
+		t.Errorf("connects: got %d, server saw %d", summary.Connects, len(stream.times()))
+	}
+	for reason, count := range summary.Failures {
+		if count != 0 {
+			t.Errorf("failures %s: got %d, want 0", reason, count)
+		}
+	}
+}
+
+func TestFailures(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	ending := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1024))
+	}))
+	defer ending.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		reason string
+	}{
+		{"status", unavailable.URL, FailureStatus},
+		{"read", ending.URL, FailureRead},
+		{"connect", closed.URL, FailureConnect},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{Url: test.url, Clients: 1, Duration: 500 * time.Millisecond, Timeout: time.Second}
+			summary := NewGenerator(config, util.MetricsControl{}).Run()
+			if summary.Failures[test.reason] == 0 {
+				t.Errorf("failures: got %v, want %s", summary.Failures, test.reason)
+			}
+			if test.reason != FailureRead && summary.Connects != 0 {
+				t.Errorf("connects: got %d, want 0", summary.Connects)
+			}
+		})
+	}
+}
+
+type failingValidator struct{}
+
+func (failingValidator) Validate(data []byte, failEarly bool) error {
+	return errors.New("bitrate")
+}
+
+func TestSampledValidator(t *testing.T) {
+	g := NewGenerator(Config{Url: "http://localhost"}, util.MetricsControl{})
+	validator := &sampledValidator{generator: g, validator: failingValidator{}}
+
+	// no data yet, the client is not connected
+	validator.Validate(nil, false)
+	if validator.connected || g.active.Load() != 0 {
+		t.Error("connected without data")
+	}
+	validator.Validate(make([]byte, 100), false)
+	validator.Validate(make([]byte, 50), false)
+
+	summary := g.summary(time.Second)
+	if summary.Connects != 1 || g.active.Load() != 1 {
+		t.Errorf("connects: got %d, active %d, want 1", summary.Connects, g.active.Load())
+	}
+	if summary.Bytes != 150 {
+		t.Errorf("bytes: got %d, want 150", summary.Bytes)
+	}
+	if summary.Failures[FailureValidate] != 1 {
+		t.Errorf("validate failures: got %d, want 1", summary.Failures[FailureValidate])
+	}
+	if len(g.latencies) != 0 {
+		t.Errorf("latencies: got %v, want none", g.latencies)
+	}
+}
+
+func TestSummaryJson(t *testing.T) {
+	g := NewGenerator(Config{Url: "http://localhost", Clients: 2}, util.MetricsControl{})
+	g.connected(100 * time.Millisecond)
+	g.connected(300 * time.Millisecond)
+	g.bytes.Add(1000)
+	g.fail(FailureRead, errors.New("reset"))
+
+	data, err := json.Marshal(g.summary(2 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary map[string]any
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"url":            "http://localhost",
+		"clients":        2.0,
+		"connects":       2.0,
+		"bytes":          1000.0,
+		"throughputBits": 4000.0,
+	}
+	for key, value := range want {
+		if summary[key] != value {
+			t.Errorf("%s: got %v, want %v", key, summary[key], value)
+		}
+	}
+	failures := summary["failures"].(map[string]any)
+	if failures[FailureRead] != 1.0 || failures[FailureConnect] != 0.0 {
+		t.Errorf("failures: got %v", failures)
+	}
+	latency := summary["connectLatency"].(map[string]any)
+	if latency["max"] != 0.3 {
+		t.Errorf("max latency: got %v, want 0.3", latency["max"])
+	}
+}
@@ -0,0 +1,27 @@
+package load
+
+import (
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type loadMetrics struct {
+	clients        prometheus.Gauge
+	connects       prometheus.Counter
+	failures       *prometheus.CounterVec
+	bytes          prometheus.Counter
+	throughput     prometheus.Gauge
+	connectLatency prometheus.Histogram
+}
+
+func newLoadMetrics(control util.MetricsControl) *loadMetrics {
+	return &loadMetrics{
+		clients:        metricmanager.NewGauge(control, "load_clients", "Connected listeners."),
+		connects:       metricmanager.NewCounter(control, "load_connects_total", "Successful listener connects."),
+		failures:       metricmanager.NewCounterVec(control, "load_failures_total", "Listener failures by reason.", []string{"reason"}),
+		bytes:          metricmanager.NewCounter(control, "load_bytes_total", "Bytes received by all listeners."),
+		throughput:     metricmanager.NewGauge(control, "load_throughput_bits", "Aggregate throughput in bit/s."),
+		connectLatency: metricmanager.NewHistogram(control, "load_connect_duration_seconds", "Time until response headers.", prometheus.DefBuckets),
+	}
+}
@@ -0,0 +1,176 @@
+package loudness
+
+import (
+	"math"
+)
+
+// k-weighting
+
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+	// state
+	x1, x2 float64
+	y1, y2 float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kFilter is the K-weighting of ITU-R BS.1770, a high shelf followed by a
+// high pass. Coefficients are derived for the sample rate, at 48kHz they
+// match the ones of the recommendation.
+type kFilter struct {
+	shelf    biquad
+	highPass biquad
+}
+
+func newKFilter(sampleRate int) kFilter {
+	fs := float64(sampleRate)
+
+	// high shelf of about +4dB above 1.5kHz
+	k := math.Tan(math.Pi * 1681.974450955533 / fs)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// high pass at 38Hz
+	k = math.Tan(math.Pi * 38.13547087602444 / fs)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return kFilter{shelf: shelf, highPass: highPass}
+}
+
+func (f *kFilter) process(x float64) float64 {
+	return f.highPass.process(f.shelf.process(x))
+}
+
+func (f *kFilter) reset() {
+	f.shelf.x1, f.shelf.x2, f.shelf.y1, f.shelf.y2 = 0, 0, 0, 0
+	f.highPass.x1, f.highPass.x2, f.highPass.y1, f.highPass.y2 = 0, 0, 0, 0
+}
+
+// true-peak
+
+const (
+	OVERSAMPLING int = 4
+	PHASE_TAPS   int = 12
+)
+
+// interpolation filter of 4 times oversampling, a windowed sinc by phase
+var interpolation = func() [OVERSAMPLING][PHASE_TAPS]float64 {
+	var phases [OVERSAMPLING][PHASE_TAPS]float64
+	length := OVERSAMPLING * PHASE_TAPS
+	center := float64(length-1) / 2
+	for i := 0; i < length; i++ {
+		t := (float64(i) - center) / float64(OVERSAMPLING)
+		sinc := 1.0
+		if t != 0 {
+			sinc = math.Sin(math.Pi*t) / (math.Pi * t)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*(float64(i)+0.5)/float64(length))
+		phases[i%OVERSAMPLING][i/OVERSAMPLING] = sinc * window
+	}
+	// unity gain for every phase
+	for p := range phases {
+		sum := 0.0
+		for _, tap := range phases[p] {
+			sum += tap
+		}
+		for k := range phases[p] {
+			phases[p][k] /= sum
+		}
+	}
+	return phases
+}()
+
+// truePeak estimates the peak between samples by oversampling, as described
+// in annex 2 of ITU-R BS.1770.
+type truePeak struct {
+	history [PHASE_TAPS]float64
+	pos     int
+}
+
+// process returns the absolute peak of x and the interpolated samples
+// before it.
+func (t *truePeak) process(x float64) float64 {
+	t.pos = (t.pos + 1) % PHASE_TAPS
+	t.history[t.pos] = x
+	peak := math.Abs(x)
+	for p := range interpolation {
+		y := 0.0
+		for k, tap := range interpolation[p] {
+			y += tap * t.history[(t.pos-k+PHASE_TAPS)%PHASE_TAPS]
+		}
+		peak = math.Max(peak, math.Abs(y))
+	}
+	return peak
+}
+
+func (t *truePeak) reset() {
+	*t = truePeak{}
+}
+
+// integrated loudness
+
+const (
+	HISTOGRAM_STEP float64 = 0.1
+	HISTOGRAM_MAX  float64 = 5
+)
+
+// histogram counts gating blocks above the absolute gate by loudness, to
+// integrate the loudness of a stream in constant memory.
+type histogram struct {
+	counts [int((HISTOGRAM_MAX - ABSOLUTE_GATE) / HISTOGRAM_STEP)]int
+}
+
+func (h *histogram) add(energy float64) {
+	loudness := Lufs(energy)
+	if loudness < ABSOLUTE_GATE {
+		return
+	}
+	bin := min(int((loudness-ABSOLUTE_GATE)/HISTOGRAM_STEP), len(h.counts)-1)
+	h.counts[bin]++
+}
+
+// integrated returns the loudness of the blocks above the relative gate.
+func (h *histogram) integrated() float64 {
+	relative := h.mean(ABSOLUTE_GATE) + RELATIVE_GATE
+	return h.mean(relative)
+}
+
+// mean returns the loudness of the mean energy of all bins above gate.
+func (h *histogram) mean(gate float64) float64 {
+	sum, count := 0.0, 0
+	for bin, n := range h.counts {
+		loudness := ABSOLUTE_GATE + (float64(bin)+0.5)*HISTOGRAM_STEP
+		if n == 0 || loudness < gate {
+			continue
+		}
+		sum += float64(n) * math.Pow(10, (loudness+0.691)/10)
+		count += n
+	}
+	if count == 0 {
+		return MIN_LUFS
+	}
+	return Lufs(sum / float64(count))
+}
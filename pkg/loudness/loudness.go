@@ -0,0 +1,228 @@
+package loudness
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/level"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	BLOCK             time.Duration = 100 * time.Millisecond
+	MOMENTARY_BLOCKS  int           = 4
+	SHORT_TERM_BLOCKS int           = 30
+	ABSOLUTE_GATE     float64       = -70
+	RELATIVE_GATE     float64       = -10
+	OUT_OF_RANGE      time.Duration = 10 * time.Second
+	// loudness of digital silence
+	MIN_LUFS float64 = -120
+)
+
+// Meter measures loudness of decoded samples as defined by EBU R128 and ITU-R
+// BS.1770: momentary (400ms), short-term (3s) and integrated loudness since
+// start, and the true-peak of the last 3s. With loudness expectations, the
+// short-term loudness and true-peak are validated. Received frames are
+// decoded by mp3.PcmHandler.
+type Meter struct {
+	expectations configmanager.LoudnessExpectations
+	duration     time.Duration
+
+	sampleRate int
+	filters    []kFilter
+	peaks      []truePeak
+
+	// current block
+	sum     float64
+	peak    float64
+	samples int
+
+	// last blocks, newest last
+	energies []float64
+	blockMax []float64
+	gating   histogram
+
+	momentary  prometheus.Gauge
+	shortTerm  prometheus.Gauge
+	integrated prometheus.Gauge
+	truePeak   prometheus.Gauge
+	alerts     prometheus.Counter
+
+	mu         sync.Mutex
+	outOfRange time.Duration
+	alert      error
+}
+
+func NewMeter(expectations configmanager.LoudnessExpectations, metrics util.MetricsControl) *Meter {
+	m := &Meter{
+		expectations: expectations,
+		duration:     OUT_OF_RANGE,
+	}
+	if expectations.DurationSec > 0 {
+		m.duration = time.Duration(expectations.DurationSec * float64(time.Second))
+	}
+
+	m.momentary = metricmanager.NewGauge(metrics, "loudness_momentary_lufs", "Momentary loudness in LUFS.")
+	m.shortTerm = metricmanager.NewGauge(metrics, "loudness_shortterm_lufs", "Short-term loudness in LUFS.")
+	m.integrated = metricmanager.NewGauge(metrics, "loudness_integrated_lufs", "Integrated loudness since start in LUFS.")
+	m.truePeak = metricmanager.NewGauge(metrics, "true_peak_dbtp", "True-peak of the last 3s in dBTP.")
+	m.alerts = metricmanager.NewCounter(metrics, "loudness_alerts_total", "Loudness out of range for longer than the expected duration.")
+	return m
+}
+
+// Push adds decoded samples by channel.
+func (m *Meter) Push(pcm [][]float32, sampleRate int) {
+	if len(pcm) == 0 {
+		return
+	}
+	if sampleRate != m.sampleRate || len(pcm) != len(m.filters) {
+		m.sampleRate = sampleRate
+		m.filters = make([]kFilter, len(pcm))
+		m.peaks = make([]truePeak, len(pcm))
+		for ch := range m.filters {
+			m.filters[ch] = newKFilter(sampleRate)
+		}
+		m.reset()
+	}
+
+	blockSize := int(BLOCK.Seconds() * float64(sampleRate))
+	for i := range pcm[0] {
+		for ch, channel := range pcm {
+			sample := float64(channel[i])
+			filtered := m.filters[ch].process(sample)
+			m.sum += filtered * filtered
+			m.peak = math.Max(m.peak, m.peaks[ch].process(sample))
+		}
+		m.samples++
+		if m.samples >= blockSize {
+			m.block()
+		}
+	}
+}
+
+func (m *Meter) Reset() {
+	for ch := range m.filters {
+		m.filters[ch].reset()
+		m.peaks[ch].reset()
+	}
+	m.reset()
+}
+
+// Check fails while the stream is out of range for longer than the expected
+// duration.
+func (m *Meter) Check() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.alert
+}
+
+// Integrated returns the integrated loudness since start.
+func (m *Meter) Integrated() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gating.integrated()
+}
+
+func (m *Meter) reset() {
+	m.sum, m.peak, m.samples = 0, 0, 0
+	m.energies = m.energies[:0]
+	m.blockMax = m.blockMax[:0]
+}
+
+// block completes a block of 100ms. Channels are weighted equally, only mono
+// and stereo are decoded.
+func (m *Meter) block() {
+	m.energies = append(m.energies, m.sum/float64(m.samples))
+	m.blockMax = append(m.blockMax, m.peak)
+	m.sum, m.peak, m.samples = 0, 0, 0
+	if len(m.energies) > SHORT_TERM_BLOCKS {
+		m.energies = m.energies[1:]
+		m.blockMax = m.blockMax[1:]
+	}
+	if len(m.energies) < MOMENTARY_BLOCKS {
+		return
+	}
+
+	momentaryEnergy := mean(m.energies[len(m.energies)-MOMENTARY_BLOCKS:])
+	momentary := Lufs(momentaryEnergy)
+	m.momentary.Set(momentary)
+	m.mu.Lock()
+	m.gating.add(momentaryEnergy)
+	integrated := m.gating.integrated()
+	m.mu.Unlock()
+	m.integrated.Set(integrated)
+
+	if len(m.energies) < SHORT_TERM_BLOCKS {
+		return
+	}
+	shortTerm := Lufs(mean(m.energies))
+	peak := 0.0
+	for _, blockMax := range m.blockMax {
+		peak = math.Max(peak, blockMax)
+	}
+	truePeak := level.Dbfs(peak)
+	m.shortTerm.Set(shortTerm)
+	m.truePeak.Set(truePeak)
+	m.validate(shortTerm, truePeak)
+}
+
+func (m *Meter) validate(shortTerm float64, truePeak float64) {
+	e := m.expectations
+	var problem string
+	switch {
+	case shortTerm < ABSOLUTE_GATE:
+		// silence is neither in nor out of range
+		return
+	case e.MinLufs != 0 && shortTerm < e.MinLufs:
+		problem = fmt.Sprintf("short-term loudness %.1f LUFS below %.1f LUFS", shortTerm, e.MinLufs)
+	case e.MaxLufs != 0 && shortTerm > e.MaxLufs:
+		problem = fmt.Sprintf("short-term loudness %.1f LUFS above %.1f LUFS", shortTerm, e.MaxLufs)
+	case e.MaxTruePeakDb != 0 && truePeak > e.MaxTruePeakDb:
+		problem = fmt.Sprintf("true-peak %.1f dBTP above %.1f dBTP", truePeak, e.MaxTruePeakDb)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if problem == "" {
+		if m.alert != nil {
+			log.Info("loudness in range after", m.outOfRange.Round(time.Second), "short-term", shortTerm, "LUFS")
+		}
+		m.outOfRange, m.alert = 0, nil
+		return
+	}
+	m.outOfRange += BLOCK
+	if m.outOfRange < m.duration {
+		return
+	}
+	if m.alert == nil {
+		m.alerts.Inc()
+		log.Warn("loudness out of range for", m.outOfRange.Round(time.Second), problem)
+	}
+	m.alert = errors.New(problem + " for " + m.outOfRange.Round(time.Second).String())
+}
+
+// Lufs returns the loudness of the mean square energy of K-weighted samples,
+// at least MIN_LUFS.
+func Lufs(energy float64) float64 {
+	if energy <= 0 {
+		return MIN_LUFS
+	}
+	return math.Max(MIN_LUFS, -0.691+10*math.Log10(energy))
+}
+
+// helper
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,91 @@
+package loudness
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestKFilter(t *testing.T) {
+	// coefficients of ITU-R BS.1770 at 48kHz
+	f := newKFilter(48000)
+	expected := []float64{1.53512485958697, -2.69169618940638, 1.19839281085285, -1.69065929318241, 0.73248077421585, -1.99004745483398, 0.99007225036621}
+	got := []float64{f.shelf.b0, f.shelf.b1, f.shelf.b2, f.shelf.a1, f.shelf.a2, f.highPass.a1, f.highPass.a2}
+	for i := range expected {
+		if math.Abs(got[i]-expected[i]) > 1e-6 {
+			t.Errorf("coefficient %d: got %.14f, want %.14f", i, got[i], expected[i])
+		}
+	}
+}
+
+// sine returns seconds of a stereo sine of frequency at amplitude.
+func sine(frequency float64, amplitude float64, phase float64, seconds float64, sampleRate int) [][]float32 {
+	samples := make([]float32, int(seconds*float64(sampleRate)))
+	for i := range samples {
+		samples[i] = float32(amplitude * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate)+phase))
+	}
+	return [][]float32{samples, samples}
+}
+
+func TestMeter(t *testing.T) {
+	m := NewMeter(configmanager.LoudnessExpectations{}, util.MetricsControl{})
+
+	// stereo 1kHz sine at -20dBFS is -20 LUFS
+	m.Push(sine(997, 0.1, 0, 5, 48000), 48000)
+	for name, gauge := range map[string]float64{
+		"momentary":  testutil.ToFloat64(m.momentary),
+		"short-term": testutil.ToFloat64(m.shortTerm),
+		"integrated": testutil.ToFloat64(m.integrated),
+		"true-peak":  testutil.ToFloat64(m.truePeak),
+	} {
+		if math.Abs(gauge+20) > 0.1 {
+			t.Errorf("%s: got %f", name, gauge)
+		}
+	}
+
+	// the relative gate ignores the quiet part
+	m.Push(sine(997, 0.01, 0, 5, 48000), 48000)
+	if integrated := m.Integrated(); math.Abs(integrated+20) > 0.2 {
+		t.Errorf("gated integrated: got %f", integrated)
+	}
+	if shortTerm := testutil.ToFloat64(m.shortTerm); math.Abs(shortTerm+40) > 0.1 {
+		t.Errorf("short-term: got %f", shortTerm)
+	}
+
+	// samples of a quarter of the sample rate miss the peak by 3dB
+	m.Push(sine(12000, 0.5, math.Pi/4, 4, 48000), 48000)
+	if truePeak := testutil.ToFloat64(m.truePeak); math.Abs(truePeak+6.02) > 0.3 {
+		t.Errorf("true-peak: got %f", truePeak)
+	}
+}
+
+func TestMeterExpectations(t *testing.T) {
+	m := NewMeter(configmanager.LoudnessExpectations{MinLufs: -18, MaxLufs: -14, DurationSec: 2}, util.MetricsControl{})
+
+	m.Push(sine(997, 0.1, 0, 4, 44100), 44100)
+	if m.Check() != nil {
+		t.Error("alert before duration")
+	}
+	m.Push(sine(997, 0.1, 0, 2, 44100), 44100)
+	if err := m.Check(); err == nil {
+		t.Error("no alert below range")
+	}
+	if alerts := testutil.ToFloat64(m.alerts); alerts != 1 {
+		t.Errorf("alerts: got %f", alerts)
+	}
+
+	// -16 LUFS
+	m.Push(sine(997, 0.1585, 0, 4, 44100), 44100)
+	if err := m.Check(); err != nil {
+		t.Errorf("in range: got %v", err)
+	}
+
+	// silence is not out of range
+	m.Push([][]float32{make([]float32, 10*44100)}, 44100)
+	if err := m.Check(); err != nil {
+		t.Errorf("silence: got %v", err)
+	}
+}
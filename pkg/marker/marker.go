@@ -0,0 +1,105 @@
+package marker
+
+import (
+	"time"
+)
+
+// A marker is carried in the copyright bits of consecutive frames:
+//
+//	start bit (1) | id (ID_BITS, msb first) | even parity bit
+//
+// The id is the send time of the start frame in TICK units. Frames between
+// markers must not have the copyright bit set, so the decoder re-syncs on every
+// start bit. Private bits are left to the privateBit validation of readey.
+
+const (
+	ID_BITS     int           = 24
+	MARKER_BITS int           = ID_BITS + 2
+	TICK        time.Duration = 10 * time.Millisecond
+	ID_MASK     uint32        = 1<<ID_BITS - 1
+)
+
+func IdFromTime(t time.Time) uint32 {
+	return uint32(t.UnixMilli()/TICK.Milliseconds()) & ID_MASK
+}
+
+// TimeFromId returns the latest send time matching the id which is not after
+// reference. The id wraps every 2^ID_BITS ticks (~46h).
+func TimeFromId(id uint32, reference time.Time) time.Time {
+	refTicks := reference.UnixMilli() / TICK.Milliseconds()
+	diff := (uint32(refTicks) - id) & ID_MASK
+	return time.UnixMilli((refTicks - int64(diff)) * TICK.Milliseconds())
+}
+
+// Encode returns the copyright bits of all frames of the marker.
+func Encode(id uint32) []bool {
+	bits := make([]bool, 0, MARKER_BITS)
+	bits = append(bits, true)
+	parity := false
+	for i := ID_BITS - 1; i >= 0; i-- {
+		bit := (id>>i)&1 == 1
+		parity = parity != bit
+		bits = append(bits, bit)
+	}
+	return append(bits, parity)
+}
+
+// decoder
+
+type Marker struct {
+	Id       uint32
+	Received time.Time
+}
+
+type Decoder struct {
+	bits     []bool
+	received time.Time
+	Invalid  int
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{bits: make([]bool, 0, MARKER_BITS)}
+}
+
+// Push adds the copyright bit of the next frame and returns a marker, as soon as
+// all frames of a valid marker were received. The receive time of the marker
+// is the receive time of its start frame.
+func (d *Decoder) Push(bit bool, received time.Time) (Marker, bool) {
+	if len(d.bits) == 0 {
+		if !bit {
+			return Marker{}, false
+		}
+		d.received = received
+	}
+	d.bits = append(d.bits, bit)
+	if len(d.bits) < MARKER_BITS {
+		return Marker{}, false
+	}
+
+	// complete
+	id, ok := decode(d.bits)
+	d.bits = d.bits[:0]
+	if !ok {
+		d.Invalid++
+		return Marker{}, false
+	}
+	return Marker{Id: id, Received: d.received}, true
+}
+
+// Reset drops a partially received marker, e.g. after a reconnect.
+func (d *Decoder) Reset() {
+	d.bits = d.bits[:0]
+}
+
+func decode(bits []bool) (uint32, bool) {
+	var id uint32
+	parity := false
+	for _, bit := range bits[1 : ID_BITS+1] {
+		id <<= 1
+		if bit {
+			id |= 1
+		}
+		parity = parity != bit
+	}
+	return id, parity == bits[ID_BITS+1]
+}
@@ -0,0 +1,70 @@
+package marker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	id := uint32(0xA5F00F)
+	received := time.Now()
+
+	decoder := NewDecoder()
+	// leading frames without marker
+	for i := 0; i < 5; i++ {
+		if _, ok := decoder.Push(false, received); ok {
+			t.Errorf("marker without start bit")
+		}
+	}
+
+	var got Marker
+	found := false
+	for i, bit := range Encode(id) {
+		m, ok := decoder.Push(bit, received.Add(time.Duration(i)*time.Second))
+		if ok {
+			got = m
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("marker not decoded")
+	}
+	if got.Id != id {
+		t.Errorf("id: got %x != want %x", got.Id, id)
+	}
+	if !got.Received.Equal(received) {
+		t.Errorf("received: got %v != want %v", got.Received, received)
+	}
+}
+
+func TestDecodeInvalidParity(t *testing.T) {
+	bits := Encode(42)
+	bits[len(bits)-1] = !bits[len(bits)-1]
+
+	decoder := NewDecoder()
+	for _, bit := range bits {
+		if _, ok := decoder.Push(bit, time.Now()); ok {
+			t.Errorf("invalid marker decoded")
+		}
+	}
+	if decoder.Invalid != 1 {
+		t.Errorf("invalid: got %d != want %d", decoder.Invalid, 1)
+	}
+}
+
+func TestTimeFromId(t *testing.T) {
+	sent := time.UnixMilli(1700000000120)
+	id := IdFromTime(sent)
+
+	got := TimeFromId(id, sent.Add(20*time.Second))
+	if !got.Equal(sent) {
+		t.Errorf("got %v != want %v", got, sent)
+	}
+
+	// wrap around
+	wrapped := time.UnixMilli(int64(ID_MASK+1) * TICK.Milliseconds() * 3)
+	got = TimeFromId(IdFromTime(wrapped.Add(-TICK)), wrapped.Add(time.Second))
+	if !got.Equal(wrapped.Add(-TICK)) {
+		t.Errorf("wrap: got %v != want %v", got, wrapped.Add(-TICK))
+	}
+}
@@ -0,0 +1,176 @@
+package metadata
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+const (
+	SIGNATURE_HEADER string        = "X-Signature"
+	TIMESTAMP_HEADER string        = "X-Timestamp"
+	TOKEN_MARGIN     time.Duration = 30 * time.Second
+)
+
+// authenticator adds credentials to a request. invalidate drops cached
+// credentials after a 401.
+type authenticator interface {
+	authenticate(req *http.Request, body []byte) error
+	invalidate()
+}
+
+// newAuthenticator returns nil, if config has no auth type.
+func newAuthenticator(config configmanager.AuthConfig, client *http.Client) (authenticator, error) {
+	switch strings.ToLower(config.Type) {
+	case configmanager.AuthHmac:
+		secret, err := configmanager.GetSecret(config.Secret)
+		if err != nil {
+			return nil, err
+		}
+		header := config.Header
+		if header == "" {
+			header = SIGNATURE_HEADER
+		}
+		timestampHeader := config.TimestampHeader
+		if timestampHeader == "" {
+			timestampHeader = TIMESTAMP_HEADER
+		}
+		return &hmacAuth{secret: []byte(secret), header: header, timestampHeader: timestampHeader}, nil
+	case configmanager.AuthOAuth2:
+		secret, err := configmanager.GetSecret(config.ClientSecret)
+		if err != nil {
+			return nil, err
+		}
+		return &oauth2Auth{config: config, secret: secret, client: client}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// hmacAuth signs "<timestamp>.<body>" with HMAC-SHA256. The signature is
+// sent as "sha256=<hex>", the timestamp in unix seconds.
+type hmacAuth struct {
+	secret          []byte
+	header          string
+	timestampHeader string
+}
+
+func (a *hmacAuth) authenticate(req *http.Request, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(a.timestampHeader, timestamp)
+	req.Header.Set(a.header, "sha256="+Sign(a.secret, timestamp, body))
+	return nil
+}
+
+func (a *hmacAuth) invalidate() {}
+
+// Sign returns the hex HMAC-SHA256 of timestamp and body.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// oauth2Auth gets tokens with the client credentials grant. Tokens are cached
+// until shortly before they expire.
+type oauth2Auth struct {
+	config configmanager.AuthConfig
+	secret string
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string  `json:"access_token"`
+	TokenType   string  `json:"token_type"`
+	ExpiresIn   float64 `json:"expires_in"`
+}
+
+func (a *oauth2Auth) authenticate(req *http.Request, body []byte) error {
+	token, err := a.getToken(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *oauth2Auth) invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = ""
+}
+
+func (a *oauth2Auth) getToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expires) {
+		return a.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.config.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(a.config.ClientId), url.QueryEscape(a.secret))
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("token request: status code %d", resp.StatusCode)
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("token request: no access token")
+	}
+	a.token = token.AccessToken
+	a.expires = time.Now().Add(time.Duration(token.ExpiresIn*float64(time.Second)) - TOKEN_MARGIN)
+	if token.ExpiresIn <= 0 {
+		// no expiry, refresh after a 401 only
+		a.expires = time.Now().Add(24 * time.Hour)
+	}
+	return a.token, nil
+}
+
+// failedAuth fails all requests, if the secrets cannot be read.
+type failedAuth struct {
+	err error
+}
+
+func (a failedAuth) authenticate(req *http.Request, body []byte) error {
+	return a.err
+}
+
+func (a failedAuth) invalidate() {}
@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+func TestSenderHmac(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(secretFile, []byte("secret\n"), 0600)
+
+	var valid atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + Sign([]byte("secret"), r.Header.Get("X-Ts"), body)
+		valid.Store(r.Header.Get("X-Sig") == want)
+	}))
+	defer server.Close()
+
+	auth := configmanager.AuthConfig{Type: "hmac", Secret: "@" + secretFile, Header: "X-Sig", TimestampHeader: "X-Ts"}
+	sender := NewSender("test", configmanager.MetadataSink{Auth: auth}, util.MetricsControl{})
+	defer sender.Close()
+	if err := <-sender.Send(event(server.URL, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if !valid.Load() {
+		t.Error("invalid signature")
+	}
+}
+
+func TestSenderOAuth2(t *testing.T) {
+	var tokens atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		token := "token" + strconv.Itoa(int(tokens.Add(1)))
+		w.Write([]byte(`{"access_token": "` + token + `", "expires_in": 3600}`))
+	}))
+	defer tokenServer.Close()
+
+	// the first token is revoked
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token2" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("CLIENT_SECRET", "secret")
+	auth := configmanager.AuthConfig{Type: "oauth2", TokenUrl: tokenServer.URL, ClientId: "client", ClientSecret: "env:CLIENT_SECRET"}
+	sender := NewSender("test", configmanager.MetadataSink{Auth: auth}, util.MetricsControl{})
+	defer sender.Close()
+	for _, id := range []string{"a", "b"} {
+		if err := <-sender.Send(event(server.URL, id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// refreshed once after 401, then cached
+	if tokens.Load() != 2 {
+		t.Errorf("token requests: got %d, want 2", tokens.Load())
+	}
+}
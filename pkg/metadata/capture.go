@@ -0,0 +1,210 @@
+package metadata
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+// CaptureEntry is a metadata request as sent, one line of a capture file.
+// Retry is set for all requests of an event after the first.
+type CaptureEntry struct {
+	Time        time.Time         `json:"time"`
+	Sink        string            `json:"sink"`
+	Id          string            `json:"id"`
+	Url         string            `json:"url"`
+	Method      string            `json:"method"`
+	ContentType string            `json:"contentType"`
+	Headers     map[string]string `json:"headers"`
+	Body        string            `json:"body"`
+	Result      string            `json:"result"`
+	Retry       bool              `json:"retry,omitempty"`
+}
+
+// Event returns the captured event.
+func (e CaptureEntry) Event() Event {
+	return Event{
+		Id:          e.Id,
+		Sink:        e.Sink,
+		Url:         e.Url,
+		Method:      e.Method,
+		ContentType: e.ContentType,
+		Headers:     e.Headers,
+		Body:        []byte(e.Body),
+		Created:     e.Time,
+	}
+}
+
+// Capture appends every sent metadata request of a channel to a jsonl file.
+// Retries are captured as sent and marked.
+type Capture struct {
+	file string
+
+	mu     sync.Mutex
+	writer *os.File
+}
+
+func NewCapture(file string) (*Capture, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	writer, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Capture{file: file, writer: writer}, nil
+}
+
+// File returns the capture file.
+func (c *Capture) File() string {
+	return c.file
+}
+
+// Write appends event sent at time at with result, the label of the request
+// metric.
+func (c *Capture) Write(event Event, at time.Time, result string) {
+	line, err := json.Marshal(CaptureEntry{
+		Time:        at,
+		Sink:        event.Sink,
+		Id:          event.Id,
+		Url:         event.Url,
+		Method:      event.Method,
+		ContentType: event.ContentType,
+		Headers:     event.Headers,
+		Body:        string(event.Body),
+		Result:      result,
+		Retry:       event.Attempts > 0,
+	})
+	if err != nil {
+		log.Err(err, "cannot capture metadata", event.Id)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writer == nil {
+		return
+	}
+	if _, err := c.writer.Write(append(line, '\n')); err != nil {
+		log.Err(err, "cannot capture metadata", event.Id)
+	}
+}
+
+func (c *Capture) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writer != nil {
+		c.writer.Close()
+		c.writer = nil
+	}
+}
+
+// ReadCapture returns all entries of a capture file.
+func ReadCapture(file string) ([]CaptureEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []CaptureEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry CaptureEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// ReplayOptions of Replay. Speed divides the original relative timing, 0
+// sends without delay. Retries replays captured retries too. NewKeys sends
+// events with new idempotency keys, so sinks don't drop them as repeated.
+type ReplayOptions struct {
+	Speed   float64
+	Retries bool
+	NewKeys bool
+}
+
+// Replay sends entries to sink once each, in order and with their original
+// relative timing. Retries are skipped by default. Url, method and headers of
+// sink replace the captured ones, auth is applied as configured for sink. It
+// returns the number of failed requests.
+func Replay(entries []CaptureEntry, sink configmanager.MetadataSink, options ReplayOptions) int {
+	if !options.Retries {
+		firsts := []CaptureEntry{}
+		for _, entry := range entries {
+			if !entry.Retry {
+				firsts = append(firsts, entry)
+			}
+		}
+		entries = firsts
+	}
+	if len(entries) == 0 {
+		return 0
+	}
+	timeout := time.Duration(TIMEOUT_SEC * float64(time.Second))
+	if sink.TimeoutSec > 0 {
+		timeout = time.Duration(sink.TimeoutSec * float64(time.Second))
+	}
+	t := newTransport(sink.Name, sink, timeout)
+	defer t.close()
+
+	failed := 0
+	first := entries[0].Time
+	start := time.Now()
+	for i, entry := range entries {
+		if options.Speed > 0 {
+			offset := time.Duration(float64(entry.Time.Sub(first)) / options.Speed)
+			time.Sleep(time.Until(start.Add(offset)))
+		}
+		event := replayEvent(entry, sink)
+		if options.NewKeys {
+			event.Id = uuid.NewString()
+		}
+		result, err := t.send(event)
+		if err != nil {
+			log.Err(err, "replay metadata", i, event.Id, "failed")
+			failed++
+			continue
+		}
+		log.Info("replay metadata", i, event.Id, result)
+	}
+	return failed
+}
+
+func replayEvent(entry CaptureEntry, sink configmanager.MetadataSink) Event {
+	event := entry.Event()
+	event.Sink = sink.Name
+	event.Created = time.Now()
+	if sink.TargetUrl != "" {
+		event.Url = sink.TargetUrl
+	}
+	if sink.Method != "" {
+		event.Method = sink.Method
+	}
+	if len(sink.Headers) > 0 {
+		headers := map[string]string{}
+		for k, v := range event.Headers {
+			headers[k] = v
+		}
+		for k, v := range sink.Headers {
+			headers[k] = v
+		}
+		event.Headers = headers
+	}
+	return event
+}
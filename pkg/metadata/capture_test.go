@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+func TestCaptureReplay(t *testing.T) {
+	s := &sink{status: []int{503}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "capture", "news.jsonl")
+	capture, err := NewCapture(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := NewSender("test", configmanager.MetadataSink{BackoffSec: 0.01}, util.MetricsControl{})
+	sender.SetCapture(capture)
+	for _, id := range []string{"a", "b"} {
+		e := event(server.URL, id)
+		e.Headers = map[string]string{"X-Channel": "news"}
+		if err := <-sender.Send(e); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	sender.Close()
+	capture.Close()
+
+	// retries are captured as sent and marked
+	entries, err := ReadCapture(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Result != "503" || entries[1].Body != "a" || entries[2].Body != "b" {
+		t.Fatalf("entries: got %+v", entries)
+	}
+	if entries[0].Retry || !entries[1].Retry || entries[2].Retry {
+		t.Errorf("retries: got %v %v %v", entries[0].Retry, entries[1].Retry, entries[2].Retry)
+	}
+	if entries[2].Headers["X-Channel"] != "news" || entries[2].Url != server.URL {
+		t.Errorf("entry: got %+v", entries[2])
+	}
+
+	// replay to another sink with relative timing, without retries
+	target := &sink{}
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+	replaySink := configmanager.MetadataSink{Name: "replay", TargetUrl: targetServer.URL}
+	start := time.Now()
+	failed := Replay(entries, replaySink, ReplayOptions{Speed: 1})
+	if failed != 0 {
+		t.Errorf("failed: got %d", failed)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("timing: got %v", elapsed)
+	}
+	if len(target.received) != 2 || target.received[0] != "a" || target.keys[0] != "a" || target.keys[1] != "b" {
+		t.Errorf("replayed: got %v, keys %v", target.received, target.keys)
+	}
+
+	// faster, with retries and new keys
+	start = time.Now()
+	Replay(entries, replaySink, ReplayOptions{Retries: true, NewKeys: true})
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("no delay: got %v", elapsed)
+	}
+	if len(target.received) != 5 || target.received[3] != "a" {
+		t.Fatalf("replayed: got %v", target.received)
+	}
+	if target.keys[2] == "a" || target.keys[3] == "a" || target.keys[2] == target.keys[3] {
+		t.Errorf("new keys: got %v", target.keys)
+	}
+}
+
+func TestSpoolRetries(t *testing.T) {
+	s := &sink{status: []int{503, 503}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	folder := t.TempDir()
+	capture, err := NewCapture(filepath.Join(folder, "capture.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noRetries := 0
+	sender := NewSender("test", configmanager.MetadataSink{Retries: &noRetries, SpoolFolder: filepath.Join(folder, "spool")}, util.MetricsControl{})
+	sender.SetCapture(capture)
+	// every send replays the spool first
+	for _, id := range []string{"a", "b"} {
+		if err := <-sender.Send(event(server.URL, id)); err != ErrSpooled {
+			t.Fatalf("%s: got %v, want spooled", id, err)
+		}
+	}
+	if err := <-sender.Send(event(server.URL, "c")); err != nil {
+		t.Fatal(err)
+	}
+	sender.Close()
+	capture.Close()
+
+	entries, err := ReadCapture(capture.File())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replays of spooled events are retries, b was spooled without request
+	want := []struct {
+		body  string
+		retry bool
+	}{{"a", false}, {"a", true}, {"a", true}, {"b", false}, {"c", false}}
+	if len(entries) != len(want) {
+		t.Fatalf("entries: got %+v", entries)
+	}
+	for i, w := range want {
+		if entries[i].Body != w.body || entries[i].Retry != w.retry {
+			t.Errorf("entry %d: got %s retry %v, want %s retry %v", i, entries[i].Body, entries[i].Retry, w.body, w.retry)
+		}
+	}
+}
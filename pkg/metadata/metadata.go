@@ -2,6 +2,8 @@ package metadata
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -9,100 +11,153 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/nice-pink/goutil/pkg/data"
-	"github.com/nice-pink/goutil/pkg/log"
 	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/template"
 )
 
-type MetaTypeId int
+const IDEMPOTENCY_HEADER string = "Idempotency-Key"
+
+// Event is a rendered metadata request. Id is the uuid of the template data
+// and stays the same for all retries.
+type Event struct {
+	Id          string
+	Sink        string
+	Url         string
+	Method      string
+	ContentType string
+	Headers     map[string]string
+	Body        []byte
+	Created     time.Time
+	// Attempts counts the requests sent, retries and spool replays included.
+	Attempts int
+}
 
-const (
-	MetaTypeIdSong       MetaTypeId = 1
-	MetaTypeIdSpot       MetaTypeId = 2 // ???
-	MetaTypeIdLink       MetaTypeId = 3 // ad
-	MetaTypeIdVoiceTrack MetaTypeId = 4 // ???
-	MetaTypeIdAd         MetaTypeId = 5
-)
+// Request returns the http request of the event with idempotency key.
+func (e Event) Request(ctx context.Context) (*http.Request, error) {
+	method := e.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, e.Url, bytes.NewReader(e.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("content-type", e.ContentType)
+	req.Header.Add(IDEMPOTENCY_HEADER, e.Id)
+	for k, v := range e.Headers {
+		req.Header.Add(k, v)
+	}
+	return req, nil
+}
 
-func GetMetadataRequest(metaUrl, metaBody, contentType string, headers map[string]string, items []configmanager.PlaylistItem, loopCount int, isInit bool) *http.Request {
-	if metaUrl == "" || len(items) == 0 {
-		return nil
+// GetEvent returns the event of info for sink or nil, if there is no
+// metadata url or encoder address.
+func GetEvent(sink configmanager.MetadataSink, info template.TrackInfo) (*Event, error) {
+	if sink.Type == configmanager.SinkTypeUecp && sink.Uecp.Address == "" {
+		return nil, nil
+	}
+	if sink.Type != configmanager.SinkTypeUecp && sink.TargetUrl == "" {
+		return nil, nil
 	}
 
-	// get meta body from item
-	lenItems := len(items)
-	index := loopCount % lenItems
-	body := GetMetadataBody(metaBody, items[index], isInit)
+	// type ids of the sink
+	if len(sink.Types) > 0 {
+		info.TypeId = sink.Types.Id(info.TypeName)
+		info.Previous.TypeId = sink.Types.Id(info.Previous.TypeName)
+		info.Next.TypeId = sink.Types.Id(info.Next.TypeName)
+	}
 
-	// get request
-	metaRequest, err := http.NewRequest(http.MethodPost, metaUrl, bytes.NewReader(body))
+	var body []byte
+	var err error
+	if sink.Type == configmanager.SinkTypeUecp {
+		body, err = getRadioText(sink.Template, info)
+	} else {
+		body, err = GetMetadataBody(sink.Template, sink.ContentType, info)
+	}
 	if err != nil {
-		log.Err(err, "create meta request")
+		return nil, fmt.Errorf("render item %s: %w", itemName(info), err)
 	}
-
-	// headers
-	metaRequest.Header.Add("content-type", contentType)
-	for k, v := range headers {
-		metaRequest.Header.Add(k, v)
+	// block broken payloads
+	if sink.Type != configmanager.SinkTypeUecp {
+		if err := ValidateBody(body, sink.ContentType, sink.Validation); err != nil {
+			return nil, ValidationError{Sink: sink.Name, Item: itemName(info), Err: err}
+		}
 	}
-
-	return metaRequest
+	return &Event{
+		Id:          info.Uuid,
+		Sink:        sink.Name,
+		Url:         sink.TargetUrl,
+		Method:      sink.Method,
+		ContentType: sink.ContentType,
+		Headers:     sink.Headers,
+		Body:        body,
+		Created:     time.Now(),
+	}, nil
 }
 
-func GetMetadataBody(metaBody string, item configmanager.PlaylistItem, lastStarted bool) []byte {
+// GetMetadataBody renders the template metaBody (inline or @file) with info.
+func GetMetadataBody(metaBody string, contentType string, info template.TrackInfo) ([]byte, error) {
 	body := data.GetPayload(metaBody)
+	if body == nil && strings.HasPrefix(metaBody, "@") {
+		return nil, fmt.Errorf("template %s not readable", metaBody)
+	}
 	if body == nil {
-		return nil
+		return nil, nil
 	}
+	return template.Render(string(body), contentType, info)
+}
 
-	bodyString := string(body)
-
-	// type
-	bodyString = strings.ReplaceAll(bodyString, "{{ type_name }}", item.Type)
-	typeId := GetMetaTypeId(item.Type)
-	bodyString = strings.ReplaceAll(bodyString, "{{ type_id }}", typeId)
-
-	// ids
-	bodyString = strings.ReplaceAll(bodyString, "{{ uuid }}", uuid.NewString())
-	bodyString = strings.ReplaceAll(bodyString, "{{ id }}", "1")
-
-	// event
-	bodyString = strings.ReplaceAll(bodyString, "{{ last_started }}", strconv.FormatBool(lastStarted))
-
-	// track
-	bodyString = strings.ReplaceAll(bodyString, "{{ artist }}", item.Artist)
-	bodyString = strings.ReplaceAll(bodyString, "{{ title }}", item.Title)
-	bodyString = strings.ReplaceAll(bodyString, "{{ album }}", item.Album)
-	bodyString = strings.ReplaceAll(bodyString, "{{ filepath }}", item.Filepath)
-	bodyString = strings.ReplaceAll(bodyString, "{{ duration }}", strconv.FormatFloat(item.Duration, 'f', 3, 64))
-
-	// times
-	now := time.Now().UTC()
-	utcFormat := "2006-01-02T15:04:05Z"
-	isoFormat := "02.01.2006 15:04:05"
-	// start
-	bodyString = strings.ReplaceAll(bodyString, "{{ start_utc }}", now.Format(utcFormat))
-	bodyString = strings.ReplaceAll(bodyString, "{{ start_iso }}", now.Format(isoFormat))
-	// stop
-	stop := now.Add(time.Duration(item.Duration) * time.Second)
-	bodyString = strings.ReplaceAll(bodyString, "{{ stop_utc }}", stop.Format(utcFormat))
-	bodyString = strings.ReplaceAll(bodyString, "{{ stop_iso }}", stop.Format(isoFormat))
+// GetTrackInfo returns the template data of item starting at start.
+func GetTrackInfo(item configmanager.PlaylistItem, lastStarted bool, start time.Time) template.TrackInfo {
+	return template.TrackInfo{
+		Uuid:        uuid.NewString(),
+		Id:          "1",
+		Title:       item.Title,
+		Artist:      item.Artist,
+		Album:       item.Album,
+		Filepath:    item.Filepath,
+		Duration:    item.Duration,
+		TypeId:      configmanager.DefaultMetaTypes.Id(item.Type),
+		TypeName:    item.Type,
+		Custom:      item.Custom,
+		LastStarted: lastStarted,
+		Start:       start,
+		Stop:        start.Add(time.Duration(item.Duration * float64(time.Second))),
+	}
+}
 
-	return []byte(bodyString)
+// GetChannelTrackInfo returns the template data of item at index of the
+// playlist of config, with its position in the channel and its neighbours.
+// item differs from the playlist item on fallback.
+func GetChannelTrackInfo(config configmanager.StreamConfig, item configmanager.PlaylistItem, index int, loopCount int, sequence int64, start time.Time) template.TrackInfo {
+	types := config.Metadata.GetTypes()
+	info := GetTrackInfo(item, true, start)
+	info.TypeId = types.Id(item.Type)
+	info.Id = strconv.FormatInt(sequence, 10)
+	info.Sequence = sequence
+	info.ChannelName = config.ChannelName
+	info.LoopCount = loopCount
+	info.ItemIndex = index
+	info.Bitrate = config.Audio.Bitrate
+	info.SampleRate = config.Audio.SampleRate
+
+	items := config.Playlist.Items
+	if len(items) > 0 {
+		info.Previous = getItemInfo(items[(index-1+len(items))%len(items)], types)
+		info.Next = getItemInfo(items[(index+1)%len(items)], types)
+	}
+	return info
 }
 
-func GetMetaTypeId(typeName string) string {
-	id := MetaTypeIdSong
-	switch strings.ToLower(typeName) {
-	case "spot":
-		id = MetaTypeIdSpot
-	case "link":
-		id = MetaTypeIdLink
-	case "voicetrack":
-		id = MetaTypeIdVoiceTrack
-	case "ad":
-		id = MetaTypeIdAd
-		// default:
-		// 	id = MetaTypeIdSong
+func getItemInfo(item configmanager.PlaylistItem, types configmanager.MetaTypes) template.ItemInfo {
+	return template.ItemInfo{
+		Title:    item.Title,
+		Artist:   item.Artist,
+		Album:    item.Album,
+		Filepath: item.Filepath,
+		Duration: item.Duration,
+		TypeId:   types.Id(item.Type),
+		TypeName: item.Type,
+		Custom:   item.Custom,
 	}
-	return strconv.Itoa(int(id))
 }
@@ -0,0 +1,37 @@
+package metadata
+
+import (
+	"sync"
+
+	"github.com/nice-pink/streamey/pkg/schema"
+)
+
+// schemas are read once by file
+var schemas = struct {
+	mu    sync.Mutex
+	files map[string]*schema.Schema
+}{files: map[string]*schema.Schema{}}
+
+// LoadSchema reads file again and caches it for validation, e.g. after a
+// config change.
+func LoadSchema(file string) (*schema.Schema, error) {
+	s, err := schema.Read(file)
+	if err != nil {
+		return nil, err
+	}
+	schemas.mu.Lock()
+	defer schemas.mu.Unlock()
+	schemas.files[file] = s
+	return s, nil
+}
+
+// cachedSchema returns the schema of file, it is read on first use.
+func cachedSchema(file string) (*schema.Schema, error) {
+	schemas.mu.Lock()
+	s, ok := schemas.files[file]
+	schemas.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	return LoadSchema(file)
+}
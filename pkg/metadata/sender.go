@@ -0,0 +1,438 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	TIMEOUT_SEC     float64       = 10
+	RETRIES         int           = 3
+	BACKOFF_SEC     float64       = 1
+	MAX_BACKOFF     time.Duration = 30 * time.Second
+	REPLAY_INTERVAL time.Duration = 10 * time.Second
+	QUEUE_SIZE      int           = 100
+)
+
+var (
+	ErrSpooled  = errors.New("metadata spooled for replay")
+	ErrStopped  = errors.New("metadata sender stopped")
+	ErrCanceled = errors.New("metadata canceled")
+)
+
+// StatusError is returned for responses >= 300.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return "metadata status code " + strconv.Itoa(e.StatusCode)
+}
+
+type sendRequest struct {
+	event  Event
+	result chan error
+}
+
+// Sender delivers events in order. Network errors and 5xx are retried with
+// backoff, events that still fail are spooled and replayed before any newer
+// event, once the sink is back.
+type Sender struct {
+	name    string
+	spool   *Spool
+	metrics *senderMetrics
+	queue   chan sendRequest
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	mu        sync.Mutex
+	transport transport
+	capture   *Capture
+	retries   int
+	backoff   time.Duration
+	scheduled map[*time.Timer]chan error
+}
+
+// NewSender returns the sender of sink. name is used in logs.
+func NewSender(name string, config configmanager.MetadataSink, metrics util.MetricsControl) *Sender {
+	spool, err := NewSpool(config.SpoolFolder, config.SpoolMax)
+	if err != nil {
+		log.Err(err, name, "cannot use metadata spool folder, spool in memory", config.SpoolFolder)
+		spool, _ = NewSpool("", config.SpoolMax)
+	}
+	if spool.Len() > 0 {
+		log.Info(name, "replay", spool.Len(), "spooled metadata events")
+	}
+
+	s := &Sender{
+		name:      name,
+		spool:     spool,
+		metrics:   newSenderMetrics(metrics),
+		queue:     make(chan sendRequest, QUEUE_SIZE),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		scheduled: map[*time.Timer]chan error{},
+	}
+	s.Configure(config)
+	s.metrics.spooled.Set(float64(spool.Len()))
+	go s.run()
+	return s
+}
+
+// Configure applies timeout and retry settings. The spool is kept. Without
+// retries set, RETRIES apply.
+func (s *Sender) Configure(config configmanager.MetadataSink) {
+	timeoutSec := config.TimeoutSec
+	if timeoutSec <= 0 {
+		timeoutSec = TIMEOUT_SEC
+	}
+	retries := RETRIES
+	if config.Retries != nil {
+		retries = *config.Retries
+	}
+	backoffSec := config.BackoffSec
+	if backoffSec <= 0 {
+		backoffSec = BACKOFF_SEC
+	}
+
+	timeout := time.Duration(timeoutSec * float64(time.Second))
+	t := newTransport(s.name, config, timeout)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// keep the encoder connection and toggle state, if unchanged
+	if current, ok := s.transport.(*uecpTransport); !ok || !current.same(t) {
+		if s.transport != nil {
+			s.transport.close()
+		}
+		s.transport = t
+	}
+	s.retries = max(retries, 0)
+	s.backoff = time.Duration(backoffSec * float64(time.Second))
+}
+
+// SetCapture writes all sent requests to capture, nil stops capturing.
+func (s *Sender) SetCapture(capture *Capture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capture = capture
+}
+
+// Send queues event. The result is nil once delivered, ErrSpooled if it was
+// spooled for replay or the error of a rejected event.
+func (s *Sender) Send(event Event) <-chan error {
+	result := make(chan error, 1)
+	s.enqueue(event, result)
+	return result
+}
+
+// SendAt queues event at time at. cancel drops the event, if it wasn't queued
+// yet. Events scheduled for later are dropped on close, as they would be
+// outdated on replay.
+func (s *Sender) SendAt(event Event, at time.Time) (result <-chan error, cancel func() bool) {
+	wait := time.Until(at)
+	if wait <= 0 {
+		return s.Send(event), func() bool { return false }
+	}
+	scheduled := make(chan error, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var timer *time.Timer
+	timer = time.AfterFunc(wait, func() {
+		s.mu.Lock()
+		delete(s.scheduled, timer)
+		s.mu.Unlock()
+		s.enqueue(event, scheduled)
+	})
+	s.scheduled[timer] = scheduled
+	cancel = func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !timer.Stop() {
+			return false
+		}
+		delete(s.scheduled, timer)
+		scheduled <- ErrCanceled
+		return true
+	}
+	return scheduled, cancel
+}
+
+// Close stops delivery. Queued events are spooled, scheduled ones dropped.
+func (s *Sender) Close() {
+	s.once.Do(func() { close(s.stop) })
+	s.mu.Lock()
+	for timer, result := range s.scheduled {
+		if timer.Stop() {
+			result <- ErrStopped
+		}
+		delete(s.scheduled, timer)
+	}
+	s.mu.Unlock()
+	<-s.done
+	s.mu.Lock()
+	s.transport.close()
+	s.mu.Unlock()
+}
+
+func (s *Sender) enqueue(event Event, result chan error) {
+	if s.stopped() {
+		result <- ErrStopped
+		return
+	}
+	select {
+	case s.queue <- sendRequest{event: event, result: result}:
+	case <-s.stop:
+		result <- ErrStopped
+	}
+}
+
+func (s *Sender) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Sender) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(REPLAY_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case r := <-s.queue:
+			r.result <- s.handle(r.event)
+		case <-ticker.C:
+			s.replay()
+		case <-s.stop:
+			for {
+				select {
+				case r := <-s.queue:
+					s.push(r.event)
+					r.result <- ErrSpooled
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Sender) handle(event Event) error {
+	// keep order, older events first
+	if !s.replay() {
+		s.push(event)
+		return ErrSpooled
+	}
+	err := s.deliver(&event, true)
+	if retryable(err) {
+		s.push(event)
+		return ErrSpooled
+	}
+	return err
+}
+
+// replay delivers spooled events and returns true, if the spool is empty.
+func (s *Sender) replay() bool {
+	for {
+		event, ok := s.spool.Peek()
+		if !ok {
+			return true
+		}
+		err := s.deliver(&event, false)
+		if retryable(err) {
+			if err := s.spool.Update(event); err != nil {
+				log.Err(err, s.name, "cannot update spooled metadata", event.Id)
+			}
+			return false
+		}
+		if err != nil {
+			log.Err(err, s.name, "drop rejected spooled metadata", event.Id)
+		}
+		s.spool.Pop()
+		s.metrics.spooled.Set(float64(s.spool.Len()))
+	}
+}
+
+func (s *Sender) push(event Event) {
+	log.Warn(s.name, "spool metadata", event.Id)
+	dropped, err := s.spool.Push(event)
+	if err != nil {
+		log.Err(err, s.name, "cannot spool metadata", event.Id)
+	}
+	if dropped > 0 {
+		log.Warn(s.name, "spool full, dropped", dropped, "oldest metadata events")
+		s.metrics.dropped.Add(float64(dropped))
+	}
+	s.metrics.spooled.Set(float64(s.spool.Len()))
+}
+
+// deliver sends event, with retries and backoff if retry is set.
+func (s *Sender) deliver(event *Event, retry bool) error {
+	s.mu.Lock()
+	transport, retries, backoff, capture := s.transport, s.retries, s.backoff, s.capture
+	s.mu.Unlock()
+	if !retry {
+		retries = 0
+	}
+
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			log.Warn(s.name, "retry metadata", event.Id, "in", backoff, "after:", err)
+			s.metrics.retries.Inc()
+			if !s.sleep(backoff) {
+				return err
+			}
+			backoff = min(2*backoff, MAX_BACKOFF)
+		}
+		err = s.post(transport, capture, event)
+		if !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *Sender) post(transport transport, capture *Capture, event *Event) error {
+	start := time.Now()
+	result, err := transport.send(*event)
+	s.metrics.latency.Observe(time.Since(start).Seconds())
+	s.metrics.requests.WithLabelValues(result).Inc()
+	if capture != nil {
+		capture.Write(*event, start, result)
+	}
+	event.Attempts++
+	if err != nil {
+		log.Err(err, s.name, "send metadata error")
+	}
+	return err
+}
+
+func (s *Sender) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+// transport
+
+// transport delivers an event and returns the result label of the request
+// metric.
+type transport interface {
+	send(event Event) (string, error)
+	close()
+}
+
+// newTransport returns the transport of sink. name is used in logs.
+func newTransport(name string, config configmanager.MetadataSink, timeout time.Duration) transport {
+	if config.Type == configmanager.SinkTypeUecp {
+		return newUecpTransport(config.Uecp, timeout)
+	}
+	client := &http.Client{Timeout: timeout}
+	auth, err := newAuthenticator(config.Auth, client)
+	if err != nil {
+		log.Err(err, name, "cannot read metadata auth secret")
+		auth = failedAuth{err: err}
+	}
+	return &httpTransport{client: client, auth: auth}
+}
+
+type httpTransport struct {
+	client *http.Client
+	auth   authenticator
+}
+
+func (t *httpTransport) send(event Event) (string, error) {
+	resp, err := t.do(event)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && t.auth != nil {
+		// token may be revoked, retry once with a new one
+		t.auth.invalidate()
+		resp, err = t.do(event)
+	}
+	if err != nil {
+		return "error", err
+	}
+	if resp.StatusCode >= 300 {
+		return strconv.Itoa(resp.StatusCode), StatusError{StatusCode: resp.StatusCode}
+	}
+	return strconv.Itoa(resp.StatusCode), nil
+}
+
+// do sends event and discards the response body.
+func (t *httpTransport) do(event Event) (*http.Response, error) {
+	req, err := event.Request(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if t.auth != nil {
+		if err := t.auth.authenticate(req, event.Body); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp, nil
+}
+
+func (t *httpTransport) close() {
+	t.client.CloseIdleConnections()
+}
+
+// helper
+
+// retryable is true for network errors, 429 and 5xx.
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// metrics
+
+type senderMetrics struct {
+	requests *prometheus.CounterVec
+	latency  prometheus.Histogram
+	retries  prometheus.Counter
+	spooled  prometheus.Gauge
+	dropped  prometheus.Counter
+}
+
+func newSenderMetrics(control util.MetricsControl) *senderMetrics {
+	return &senderMetrics{
+		requests: metricmanager.NewCounterVec(control, "metadata_requests_total", "Metadata requests by result.", []string{"result"}),
+		latency:  metricmanager.NewHistogram(control, "metadata_request_duration_seconds", "Metadata request duration.", prometheus.DefBuckets),
+		retries:  metricmanager.NewCounter(control, "metadata_retries_total", "Metadata request retries."),
+		spooled:  metricmanager.NewGauge(control, "metadata_spooled_events", "Metadata events waiting for replay."),
+		dropped:  metricmanager.NewCounter(control, "metadata_dropped_total", "Spooled metadata events dropped, as the spool was full."),
+	}
+}
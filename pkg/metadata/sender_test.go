@@ -0,0 +1,168 @@
+package metadata
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/uecp"
+)
+
+type sink struct {
+	mu       sync.Mutex
+	status   []int
+	received []string
+	keys     []string
+}
+
+func (s *sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := http.StatusOK
+	if len(s.status) > 0 {
+		status, s.status = s.status[0], s.status[1:]
+	}
+	if status < 300 {
+		body, _ := io.ReadAll(r.Body)
+		s.received = append(s.received, string(body))
+		s.keys = append(s.keys, r.Header.Get(IDEMPOTENCY_HEADER))
+	}
+	w.WriteHeader(status)
+}
+
+func event(url string, id string) Event {
+	return Event{Id: id, Url: url, Body: []byte(id), Created: time.Now()}
+}
+
+func TestSenderRetry(t *testing.T) {
+	s := &sink{status: []int{503, 502}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	sender := NewSender("test", configmanager.MetadataSink{BackoffSec: 0.01}, util.MetricsControl{})
+	defer sender.Close()
+
+	if err := <-sender.Send(event(server.URL, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.received) != 1 || s.keys[0] != "a" {
+		t.Errorf("received: got %v, keys %v", s.received, s.keys)
+	}
+
+	// client errors are not retried
+	s.status = []int{400}
+	if err := <-sender.Send(event(server.URL, "b")); err != (StatusError{StatusCode: 400}) {
+		t.Errorf("rejected: got %v", err)
+	}
+}
+
+func TestSenderSpool(t *testing.T) {
+	s := &sink{status: []int{500, 500, 500}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	folder := t.TempDir()
+	retries := 2
+	config := configmanager.MetadataSink{BackoffSec: 0.01, Retries: &retries, SpoolFolder: folder}
+	sender := NewSender("test", config, util.MetricsControl{})
+	if err := <-sender.Send(event(server.URL, "a")); err != ErrSpooled {
+		t.Fatalf("spool: got %v", err)
+	}
+	sender.Close()
+
+	// spool survives restart and is replayed first
+	sender = NewSender("test", config, util.MetricsControl{})
+	defer sender.Close()
+	if sender.spool.Len() != 1 {
+		t.Fatalf("spool after restart: got %d", sender.spool.Len())
+	}
+	if err := <-sender.Send(event(server.URL, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.received) != 2 || s.received[0] != "a" || s.received[1] != "b" {
+		t.Errorf("order: got %v", s.received)
+	}
+	if sender.spool.Len() != 0 {
+		t.Errorf("spool not empty: %d", sender.spool.Len())
+	}
+}
+
+func TestSenderSendAt(t *testing.T) {
+	s := &sink{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	sender := NewSender("test", configmanager.MetadataSink{}, util.MetricsControl{})
+	defer sender.Close()
+
+	start := time.Now()
+	result, _ := sender.SendAt(event(server.URL, "a"), start.Add(50*time.Millisecond))
+	canceled, cancel := sender.SendAt(event(server.URL, "b"), start.Add(time.Hour))
+	if !cancel() || <-canceled != ErrCanceled {
+		t.Error("cancel failed")
+	}
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond || len(s.received) != 1 {
+		t.Errorf("sent after %v: %v", time.Since(start), s.received)
+	}
+}
+
+func TestSenderUecp(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data := []byte{}
+		buf := make([]byte, 1024)
+		for bytes.Count(data, []byte{uecp.STP}) < 4 {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			data = append(data, buf[:n]...)
+		}
+		received <- data
+	}()
+
+	rds := configmanager.MetadataConfig{Sinks: []configmanager.MetadataSink{
+		{Name: "rds", Type: "uecp", Uecp: configmanager.UecpConfig{Address: listener.Addr().String(), Ps: "STREAMEY"}},
+	}}.GetSinks("")[0]
+	sender := NewSender("test", rds, util.MetricsControl{})
+	defer sender.Close()
+
+	info := GetTrackInfo(configmanager.PlaylistItem{Artist: "Artist", Title: "Title"}, true, time.Now())
+	e, err := GetEvent(rds, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-sender.Send(*e); err != nil {
+		t.Fatal(err)
+	}
+
+	// PS, RT, RT+ config and tags
+	data := <-received
+	frames := bytes.Split(bytes.TrimSuffix(data, []byte{uecp.STP}), []byte{uecp.STP})
+	if len(frames) != 4 {
+		t.Fatalf("frames: got %d, % X", len(frames), data)
+	}
+	if !bytes.Contains(frames[0], []byte("STREAMEY")) || !bytes.Contains(frames[1], []byte("Artist - Title")) {
+		t.Errorf("ps or rt missing: % X", data)
+	}
+}
@@ -0,0 +1,65 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sequence counts played items of a channel. The last value is written to
+// file, so the sequence continues after a restart. An empty file name keeps
+// the sequence in memory.
+type Sequence struct {
+	file string
+
+	mu    sync.Mutex
+	value int64
+}
+
+func NewSequence(file string) (*Sequence, error) {
+	s := &Sequence{file: file}
+	if file == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, os.MkdirAll(filepath.Dir(file), 0755)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.value, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Next increments and returns the sequence.
+func (s *Sequence) Next() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value++
+	return s.value, s.write()
+}
+
+// Peek returns the next value without incrementing.
+func (s *Sequence) Peek() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value + 1
+}
+
+// write replaces the file, so a crash never leaves a partial value.
+func (s *Sequence) write() error {
+	if s.file == "" {
+		return nil
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(s.value, 10)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
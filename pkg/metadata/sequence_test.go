@@ -0,0 +1,28 @@
+package metadata
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state", "channel1.seq")
+	s, err := NewSequence(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := int64(1); want <= 3; want++ {
+		if value, err := s.Next(); value != want || err != nil {
+			t.Errorf("next: got %d, %v, want %d", value, err, want)
+		}
+	}
+
+	// continues after restart
+	s, err = NewSequence(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Peek() != 4 {
+		t.Errorf("after restart: got %d, want 4", s.Peek())
+	}
+}
@@ -0,0 +1,143 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Spool keeps undelivered events in order. Events are kept in folder, so they
+// survive a restart, or in memory if folder is empty. If max is exceeded, the
+// oldest events are dropped, a max of 0 or less keeps all events.
+type Spool struct {
+	folder string
+	max    int
+
+	mu     sync.Mutex
+	events []Event
+	files  []string
+}
+
+func NewSpool(folder string, max int) (*Spool, error) {
+	s := &Spool{folder: folder, max: max}
+	if folder == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return nil, err
+	}
+
+	// load events of the last run
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		s.files = append(s.files, entry.Name())
+	}
+	sort.Strings(s.files)
+	for _, name := range s.files {
+		event, err := readEvent(filepath.Join(folder, name))
+		if err != nil {
+			return nil, err
+		}
+		s.events = append(s.events, event)
+	}
+	return s, nil
+}
+
+// Push appends event and returns the number of dropped events.
+func (s *Spool) Push(event Event) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := ""
+	if s.folder != "" {
+		// zero padded, so names sort in order of creation
+		name = fmt.Sprintf("%020d_%s.json", event.Created.UnixNano(), event.Id)
+		data, err := json.Marshal(event)
+		if err != nil {
+			return 0, err
+		}
+		if err := os.WriteFile(filepath.Join(s.folder, name), data, 0644); err != nil {
+			return 0, err
+		}
+	}
+	s.events = append(s.events, event)
+	s.files = append(s.files, name)
+
+	dropped := 0
+	for s.max > 0 && len(s.events) > s.max {
+		s.pop()
+		dropped++
+	}
+	return dropped, nil
+}
+
+// Peek returns the oldest event.
+func (s *Spool) Peek() (Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) == 0 {
+		return Event{}, false
+	}
+	return s.events[0], true
+}
+
+// Update replaces the oldest event, if it has the id of event.
+func (s *Spool) Update(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) == 0 || s.events[0].Id != event.Id {
+		return nil
+	}
+	s.events[0] = event
+	if s.files[0] == "" {
+		return nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.folder, s.files[0]), data, 0644)
+}
+
+// Pop removes the oldest event.
+func (s *Spool) Pop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pop()
+}
+
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func (s *Spool) pop() {
+	if len(s.events) == 0 {
+		return
+	}
+	if s.files[0] != "" {
+		os.Remove(filepath.Join(s.folder, s.files[0]))
+	}
+	s.events = s.events[1:]
+	s.files = s.files[1:]
+}
+
+func readEvent(path string) (Event, error) {
+	var event Event
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return event, err
+	}
+	return event, json.Unmarshal(data, &event)
+}
@@ -0,0 +1,127 @@
+package metadata
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/template"
+	"github.com/nice-pink/streamey/pkg/uecp"
+)
+
+// radioText is the body of uecp events. Artist and title are tagged as RT+,
+// if they are part of the text.
+type radioText struct {
+	Text   string `json:"text"`
+	Artist string `json:"artist"`
+	Title  string `json:"title"`
+}
+
+func getRadioText(rtTemplate string, info template.TrackInfo) ([]byte, error) {
+	text, err := GetMetadataBody(rtTemplate, configmanager.UECP_CONTENTTYPE, info)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(radioText{Text: string(text), Artist: info.Artist, Title: info.Title})
+}
+
+// uecpTransport sends PS, RT and RT+ of events as UECP frames to a RDS
+// encoder. The connection is kept open and redialed after errors.
+type uecpTransport struct {
+	config  configmanager.UecpConfig
+	timeout time.Duration
+
+	mu         sync.Mutex
+	conn       net.Conn
+	sequence   byte
+	toggle     bool
+	lastText   string
+	itemToggle bool
+}
+
+func newUecpTransport(config configmanager.UecpConfig, timeout time.Duration) *uecpTransport {
+	return &uecpTransport{config: config, timeout: timeout}
+}
+
+func (t *uecpTransport) send(event Event) (string, error) {
+	var rt radioText
+	if err := json.Unmarshal(event.Body, &rt); err != nil {
+		return "error", err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		conn, err := net.DialTimeout(t.config.Protocol, t.config.Address, t.timeout)
+		if err != nil {
+			return "error", err
+		}
+		if t.config.Protocol == "tcp" {
+			// acknowledgements are not evaluated
+			go io.Copy(io.Discard, conn)
+		}
+		t.conn = conn
+	}
+
+	t.conn.SetWriteDeadline(time.Now().Add(t.timeout))
+	for _, frame := range t.frames(rt) {
+		if _, err := t.conn.Write(frame); err != nil {
+			t.conn.Close()
+			t.conn = nil
+			return "error", err
+		}
+	}
+	return "ok", nil
+}
+
+// frames returns PS, RT and RT+ frames. The A/B flag and the RT+ item toggle
+// change with every new text.
+func (t *uecpTransport) frames(rt radioText) [][]byte {
+	if rt.Text != t.lastText {
+		t.toggle = !t.toggle
+		t.itemToggle = !t.itemToggle
+		t.lastText = rt.Text
+	}
+	dsn, psn := byte(t.config.Dsn), byte(t.config.Psn)
+	text := uecp.Encode(rt.Text)
+
+	messages := [][]byte{}
+	if t.config.Ps != "" {
+		messages = append(messages, uecp.PS(dsn, psn, t.config.Ps))
+	}
+	messages = append(messages, uecp.RT(dsn, psn, text, t.toggle))
+	title, hasTitle := uecp.FindTag(uecp.RTPLUS_TITLE, text, rt.Title)
+	artist, hasArtist := uecp.FindTag(uecp.RTPLUS_ARTIST, text, rt.Artist)
+	if hasTitle || hasArtist {
+		messages = append(messages, uecp.RTPlusConfig(), uecp.RTPlus(title, artist, t.itemToggle, true))
+	}
+
+	address := uecp.Address(t.config.Site, t.config.Encoder)
+	frames := [][]byte{}
+	for _, message := range messages {
+		// sequence counter 0 is reserved for no counting
+		t.sequence++
+		if t.sequence == 0 {
+			t.sequence = 1
+		}
+		frames = append(frames, uecp.Frame(address, t.sequence, message))
+	}
+	return frames
+}
+
+func (t *uecpTransport) same(other transport) bool {
+	u, ok := other.(*uecpTransport)
+	return ok && u.config == t.config && u.timeout == t.timeout
+}
+
+func (t *uecpTransport) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
@@ -0,0 +1,128 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/template"
+)
+
+// ValidationError is returned for rendered bodies, which are not sent.
+type ValidationError struct {
+	Sink string
+	Item string
+	Err  error
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("invalid metadata for sink %s, item %s: %v", e.Sink, e.Item, e.Err)
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateBody checks body by content type: json must parse and match the
+// schema, xml must be well-formed and have all required elements. Other
+// content types and empty bodies are not checked.
+func ValidateBody(body []byte, contentType string, config configmanager.ValidationConfig) error {
+	if config.Disabled || len(body) == 0 {
+		return nil
+	}
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "json"):
+		return validateJson(body, config.JsonSchema)
+	case strings.Contains(contentType, "xml"):
+		return validateXml(body, config.RequiredElements)
+	}
+	return nil
+}
+
+func validateJson(body []byte, schemaFile string) error {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return err
+	}
+	if schemaFile == "" {
+		return nil
+	}
+	schema, err := cachedSchema(schemaFile)
+	if err != nil {
+		return err
+	}
+	return schema.Validate(value)
+}
+
+func validateXml(body []byte, required []string) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	found := map[string]bool{}
+	path := []string{}
+	roots := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(path) == 0 {
+				roots++
+			}
+			path = append(path, t.Name.Local)
+			found[strings.Join(path, "/")] = true
+		case xml.EndElement:
+			path = path[:len(path)-1]
+		}
+	}
+	if roots != 1 {
+		return fmt.Errorf("want one root element, got %d", roots)
+	}
+	for _, element := range required {
+		if !found[strings.Trim(element, "/")] {
+			return fmt.Errorf("required element %s missing", element)
+		}
+	}
+	return nil
+}
+
+// CheckTemplates renders the metadata of every playlist item and the fallback
+// for all sinks of config and returns all errors.
+func CheckTemplates(config configmanager.StreamConfig) []error {
+	items := config.Playlist.Items
+	if len(items) == 0 {
+		return nil
+	}
+	fallback := config.Playlist.Fallback
+	if fallback.Title == "" {
+		fallback.Title = "fallback"
+	}
+
+	errs := []error{}
+	start := time.Now()
+	for _, sink := range config.Metadata.GetSinks(config.Playlist.ContentType) {
+		for index, item := range append(items[:len(items):len(items)], fallback) {
+			info := GetChannelTrackInfo(config, item, index%len(items), 0, int64(index+1), start)
+			if _, err := GetEvent(sink, info); err != nil {
+				errs = append(errs, fmt.Errorf("channel %s, sink %s, item %d: %w", config.ChannelName, sink.Name, index, err))
+			}
+		}
+	}
+	return errs
+}
+
+// helper
+
+func itemName(info template.TrackInfo) string {
+	return fmt.Sprintf("%s - %s (%s)", info.Artist, info.Title, info.Filepath)
+}
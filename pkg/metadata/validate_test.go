@@ -0,0 +1,98 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+func TestValidateJson(t *testing.T) {
+	schemaFile := filepath.Join(t.TempDir(), "schema.json")
+	schema := `{"type": "object", "required": ["artist", "duration"], "properties": {
+		"artist": {"type": "string", "minLength": 1},
+		"duration": {"type": "number", "minimum": 0},
+		"type": {"enum": ["Song", "Ad"]}
+	}}`
+	os.WriteFile(schemaFile, []byte(schema), 0644)
+	config := configmanager.ValidationConfig{JsonSchema: schemaFile}
+
+	tests := map[string]bool{
+		`{"artist": "A", "duration": 1.5, "type": "Song"}`: true,
+		`{"artist": "A", "duration": 1.5`:                  false,
+		`{"artist": "", "duration": 1}`:                    false,
+		`{"artist": "A"}`:                                  false,
+		`{"artist": "A", "duration": -1}`:                  false,
+		`{"artist": "A", "duration": 1, "type": "Spot"}`:   false,
+	}
+	for body, valid := range tests {
+		err := ValidateBody([]byte(body), "application/json", config)
+		if (err == nil) != valid {
+			t.Errorf("%s: got %v", body, err)
+		}
+	}
+}
+
+func TestValidateXml(t *testing.T) {
+	config := configmanager.ValidationConfig{RequiredElements: []string{"event/artist", "/event/title"}}
+	tests := map[string]bool{
+		`<event><artist>A</artist><title>T</title></event>`:   true,
+		`<event><artist>A &</artist><title>T</title></event>`: false,
+		`<event><artist>A</artist></event>`:                   false,
+		`<event><artist>A</artist><title>T</title>`:           false,
+		`<a/><b/>`: false,
+	}
+	for body, valid := range tests {
+		err := ValidateBody([]byte(body), "xml", config)
+		if (err == nil) != valid {
+			t.Errorf("%s: got %v", body, err)
+		}
+	}
+}
+
+func TestCheckTemplates(t *testing.T) {
+	config := configmanager.StreamConfig{
+		ChannelName: "test",
+		Metadata:    configmanager.MetadataConfig{TargetUrl: "http://localhost", Template: `<e><a>{{ .Artist }}</a></e>`},
+		Playlist: configmanager.Playlist{ContentType: "xml", Items: []configmanager.PlaylistItem{
+			{Artist: "Simon & Garfunkel"}, {Artist: "Artist"},
+		}},
+	}
+	// unescaped ampersand of the first item
+	errs := CheckTemplates(config)
+	if len(errs) != 1 {
+		t.Fatalf("got %v", errs)
+	}
+
+	config.Metadata.Template = `<e><a>{{ .Artist | xml }}</a></e>`
+	if errs := CheckTemplates(config); len(errs) != 0 {
+		t.Errorf("got %v", errs)
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	schemaFile := filepath.Join(t.TempDir(), "schema.json")
+	os.WriteFile(schemaFile, []byte(`{"properties": {"isrc": {"type": "string", "pattern": "^[A-Z]{2}-"}}}`), 0644)
+	config := configmanager.ValidationConfig{JsonSchema: schemaFile}
+	if err := ValidateBody([]byte(`{"isrc": "de-1"}`), "json", config); err == nil {
+		t.Error("pattern not matched")
+	}
+
+	// the schema is read once, until it is loaded again
+	os.WriteFile(schemaFile, []byte(`{"properties": {"isrc": {"type": "number"}}}`), 0644)
+	if err := ValidateBody([]byte(`{"isrc": "DE-1"}`), "json", config); err != nil {
+		t.Errorf("cached schema: got %v", err)
+	}
+	if _, err := LoadSchema(schemaFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateBody([]byte(`{"isrc": "DE-1"}`), "json", config); err == nil {
+		t.Error("reloaded schema not used")
+	}
+
+	os.WriteFile(schemaFile, []byte(`{"pattern": "("}`), 0644)
+	if _, err := LoadSchema(schemaFile); err == nil {
+		t.Error("invalid pattern loaded")
+	}
+}
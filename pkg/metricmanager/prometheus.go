@@ -1,16 +1,102 @@
 package metricmanager
 
 import (
-	"net/http"
-	"strconv"
-
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // metric server
 
 func Listen(port int) {
-	http.Handle("/metrics", promhttp.Handler())
-	portString := ":" + strconv.Itoa(port)
-	http.ListenAndServe(portString, nil)
+	NewServer(port, nil).Listen()
+}
+
+// metrics
+
+// NewHistogram registers a histogram with the prefix and labels of control. If
+// metrics are disabled an unregistered histogram is returned.
+func NewHistogram(control util.MetricsControl, name string, help string, buckets []float64) prometheus.Histogram {
+	opts := prometheus.HistogramOpts{
+		Name:        control.Prefix + name,
+		Help:        help,
+		Buckets:     buckets,
+		ConstLabels: control.Labels,
+	}
+	histogram := prometheus.NewHistogram(opts)
+	if !control.Enabled {
+		return histogram
+	}
+	return register(histogram)
+}
+
+// NewCounter registers a counter with the prefix and labels of control. If
+// metrics are disabled an unregistered counter is returned.
+func NewCounter(control util.MetricsControl, name string, help string) prometheus.Counter {
+	opts := prometheus.CounterOpts{
+		Name:        control.Prefix + name,
+		Help:        help,
+		ConstLabels: control.Labels,
+	}
+	counter := prometheus.NewCounter(opts)
+	if !control.Enabled {
+		return counter
+	}
+	return register(counter)
+}
+
+// NewGauge registers a gauge with the prefix and labels of control. If metrics
+// are disabled an unregistered gauge is returned.
+func NewGauge(control util.MetricsControl, name string, help string) prometheus.Gauge {
+	opts := prometheus.GaugeOpts{
+		Name:        control.Prefix + name,
+		Help:        help,
+		ConstLabels: control.Labels,
+	}
+	gauge := prometheus.NewGauge(opts)
+	if !control.Enabled {
+		return gauge
+	}
+	return register(gauge)
+}
+
+// NewCounterVec registers a counter with variable labels with the prefix and
+// labels of control. If metrics are disabled an unregistered counter is
+// returned.
+func NewCounterVec(control util.MetricsControl, name string, help string, labels []string) *prometheus.CounterVec {
+	opts := prometheus.CounterOpts{
+		Name:        control.Prefix + name,
+		Help:        help,
+		ConstLabels: control.Labels,
+	}
+	counter := prometheus.NewCounterVec(opts, labels)
+	if !control.Enabled {
+		return counter
+	}
+	return register(counter)
+}
+
+// register registers collector or returns the already registered one, e.g.
+// when a channel is restarted.
+func register[T prometheus.Collector](collector T) T {
+	err := prometheus.Register(collector)
+	if err == nil {
+		return collector
+	}
+	if registered, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		if existing, ok := registered.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
+
+// WithLabel returns a copy of control with an additional label.
+func WithLabel(control util.MetricsControl, name string, value string) util.MetricsControl {
+	labels := map[string]string{}
+	for k, v := range control.Labels {
+		labels[k] = v
+	}
+	labels[name] = value
+	control.Labels = labels
+	return control
 }
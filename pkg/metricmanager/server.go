@@ -0,0 +1,107 @@
+package metricmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const SHUTDOWN_TIMEOUT time.Duration = 5 * time.Second
+
+// Check is the readiness of one channel or stream.
+type Check struct {
+	Ready  bool   `json:"ready"`
+	Detail string `json:"detail"`
+}
+
+// ReadyFn returns the checks by channel or url. The server is ready, if all
+// checks are ready.
+type ReadyFn func() map[string]Check
+
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// Server serves /metrics, /healthz and /readyz.
+type Server struct {
+	server *http.Server
+}
+
+func NewServer(port int, ready ReadyFn) *Server {
+	return newServer(port, true, ready)
+}
+
+// NewHealthServer serves /healthz and /readyz only, e.g. if metrics are
+// disabled.
+func NewHealthServer(port int, ready ReadyFn) *Server {
+	return newServer(port, false, ready)
+}
+
+func newServer(port int, metrics bool, ready ReadyFn) *Server {
+	mux := http.NewServeMux()
+	if metrics {
+		mux.Handle("/metrics", promhttp.Handler())
+	}
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, map[string]string{"status": "alive"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readiness := GetReadiness(ready)
+		status := http.StatusOK
+		if !readiness.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJson(w, status, readiness)
+	})
+
+	portString := ":" + strconv.Itoa(port)
+	return &Server{server: &http.Server{Addr: portString, Handler: mux}}
+}
+
+// Listen blocks until the server is shut down.
+func (s *Server) Listen() {
+	err := s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Err(err, "metric server")
+	}
+}
+
+// Shutdown stops the server gracefully, open requests are finished.
+func (s *Server) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		log.Err(err, "shutdown metric server")
+	}
+}
+
+func GetReadiness(ready ReadyFn) Readiness {
+	readiness := Readiness{Ready: true, Checks: map[string]Check{}}
+	if ready == nil {
+		return readiness
+	}
+	readiness.Checks = ready()
+	for _, check := range readiness.Checks {
+		if !check.Ready {
+			readiness.Ready = false
+		}
+	}
+	return readiness
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Err(err, "write response")
+	}
+}
@@ -2,7 +2,9 @@ package miniomanager
 
 import (
 	"context"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -42,7 +44,8 @@ func (m *MinioManger) PutFile(bucket string, destFolder string, srcFolder string
 	contentType := "application/octet-stream"
 
 	// Upload
-	info, err := m.client.FPutObject(ctx, bucket, srcFilename, srcFolder, minio.PutObjectOptions{ContentType: contentType})
+	objectName := path.Join(destFolder, srcFilename)
+	info, err := m.client.FPutObject(ctx, bucket, objectName, filepath.Join(srcFolder, srcFilename), minio.PutObjectOptions{ContentType: contentType})
 	if err != nil {
 		log.Error(err)
 		return err
@@ -60,19 +63,27 @@ func (m *MinioManger) PutFile(bucket string, destFolder string, srcFolder string
 	return nil
 }
 
+// DeleteFiles deletes all objects in folder prefix and its sub folders, which
+// are older than olderThanSec.
 func (m *MinioManger) DeleteFiles(bucket string, prefix string, olderThanSec int64) bool {
 	objectsCh := make(chan minio.ObjectInfo)
 
+	// objects are stored as <folder>/<file name>, list the folder content
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
 	// Send object names that are needed to be removed to objectsCh
 	go func() {
 		defer close(objectsCh)
 		// List all objects from a bucket-name with a matching prefix.
 		for object := range m.client.ListObjects(context.Background(), bucket, minio.ListObjectsOptions{
 			Prefix:    prefix,
-			Recursive: false,
+			Recursive: true,
 		}) {
 			if object.Err != nil {
 				log.Err(object.Err)
+				continue
 			}
 			if filesystem.IsOlderThan(object.LastModified, olderThanSec) {
 				log.Info("Delete", object)
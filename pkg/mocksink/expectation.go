@@ -0,0 +1,173 @@
+package mocksink
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	KindReceived string = "received"
+	KindAbsent   string = "absent"
+	KindWithin   string = "within"
+	KindUnique   string = "unique"
+)
+
+// Expectation on the recorded requests. Requests are selected by Match, a
+// substring of the body (all if empty):
+//
+//   - received: at least Count (default 1) requests match.
+//   - absent: no request matches.
+//   - within: matching requests arrive within WithinSec of At or of the item
+//     start in the body, group 1 of StartPattern in RFC3339. At least one
+//     request must match.
+//   - unique: the value of Header or group 1 of Pattern differs for all
+//     matching requests, e.g. the uuid.
+type Expectation struct {
+	Name         string    `json:"name"`
+	Kind         string    `json:"kind"`
+	Match        string    `json:"match"`
+	Count        int       `json:"count"`
+	At           time.Time `json:"at"`
+	StartPattern string    `json:"startPattern"`
+	WithinSec    float64   `json:"withinSec"`
+	Header       string    `json:"header"`
+	Pattern      string    `json:"pattern"`
+}
+
+type Result struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+type Report struct {
+	Passed   bool     `json:"passed"`
+	Requests int      `json:"requests"`
+	Results  []Result `json:"results"`
+}
+
+// String returns the report with one line per expectation.
+func (r Report) String() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "%s %s (%s): %s\n", status, result.Name, result.Kind, result.Detail)
+	}
+	status := "PASS"
+	if !r.Passed {
+		status = "FAIL"
+	}
+	fmt.Fprintf(&b, "%s %d expectations, %d requests\n", status, len(r.Results), r.Requests)
+	return b.String()
+}
+
+// Check returns the report of expectations on requests.
+func Check(requests []Request, expectations []Expectation) Report {
+	report := Report{Passed: true, Requests: len(requests)}
+	for _, expectation := range expectations {
+		err := expectation.check(requests)
+		result := Result{Name: expectation.Name, Kind: expectation.Kind, Passed: err == nil, Detail: "ok"}
+		if result.Name == "" {
+			result.Name = expectation.Match
+		}
+		if err != nil {
+			result.Detail = err.Error()
+			report.Passed = false
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func (e Expectation) check(requests []Request) error {
+	matching := []Request{}
+	for _, request := range requests {
+		if strings.Contains(request.Body, e.Match) {
+			matching = append(matching, request)
+		}
+	}
+
+	switch e.Kind {
+	case KindReceived:
+		count := max(e.Count, 1)
+		if len(matching) < count {
+			return fmt.Errorf("got %d matching requests, want %d", len(matching), count)
+		}
+	case KindAbsent:
+		if len(matching) > 0 {
+			return fmt.Errorf("got %d matching requests, first at %s", len(matching), matching[0].Time.Format(time.RFC3339Nano))
+		}
+	case KindWithin:
+		return e.checkWithin(matching)
+	case KindUnique:
+		return e.checkUnique(matching)
+	default:
+		return fmt.Errorf("unknown kind %s", e.Kind)
+	}
+	return nil
+}
+
+func (e Expectation) checkWithin(matching []Request) error {
+	if len(matching) == 0 {
+		return fmt.Errorf("no matching request")
+	}
+	var pattern *regexp.Regexp
+	if e.StartPattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(e.StartPattern); err != nil {
+			return err
+		}
+	}
+	tolerance := time.Duration(e.WithinSec * float64(time.Second))
+	for i, request := range matching {
+		start := e.At
+		if pattern != nil {
+			match := pattern.FindStringSubmatch(request.Body)
+			if len(match) < 2 {
+				return fmt.Errorf("request %d: no start time", i)
+			}
+			t, err := time.Parse(time.RFC3339Nano, match[1])
+			if err != nil {
+				return fmt.Errorf("request %d: %w", i, err)
+			}
+			start = t
+		}
+		if delta := request.Time.Sub(start); delta.Abs() > tolerance {
+			return fmt.Errorf("request %d: arrived %v from start, want within %v", i, delta.Round(time.Millisecond), tolerance)
+		}
+	}
+	return nil
+}
+
+func (e Expectation) checkUnique(matching []Request) error {
+	var pattern *regexp.Regexp
+	if e.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(e.Pattern); err != nil {
+			return err
+		}
+	}
+	seen := map[string]int{}
+	for i, request := range matching {
+		value := request.Headers[http.CanonicalHeaderKey(e.Header)]
+		if pattern != nil {
+			match := pattern.FindStringSubmatch(request.Body)
+			if len(match) < 2 {
+				return fmt.Errorf("request %d: no value", i)
+			}
+			value = match[1]
+		}
+		if first, ok := seen[value]; ok {
+			return fmt.Errorf("requests %d and %d: duplicate %s", first, i, value)
+		}
+		seen[value] = i
+	}
+	return nil
+}
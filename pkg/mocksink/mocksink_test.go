@@ -0,0 +1,70 @@
+package mocksink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/metadata"
+)
+
+func TestSink(t *testing.T) {
+	sink := New()
+	server := httptest.NewServer(sink)
+	defer server.Close()
+
+	config := configmanager.MetadataSink{
+		Name:        "mock",
+		TargetUrl:   server.URL + "/meta",
+		ContentType: "json",
+		Template:    `{"artist": {{ .Artist | json }}, "start": "{{ .Start | utc | format "2006-01-02T15:04:05.999Z07:00" }}"}`,
+	}
+	sender := metadata.NewSender("test", config, util.MetricsControl{})
+	defer sender.Close()
+
+	start := time.Now()
+	for _, artist := range []string{"A", "B"} {
+		info := metadata.GetTrackInfo(configmanager.PlaylistItem{Artist: artist}, true, start)
+		event, err := metadata.GetEvent(config, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender.Send(*event)
+	}
+	if !sink.Wait(2, time.Second) {
+		t.Fatalf("got %d requests", len(sink.Requests()))
+	}
+
+	sink.Expect(
+		Expectation{Kind: KindReceived, Match: `"artist": "A"`},
+		Expectation{Kind: KindWithin, Match: `"artist": "B"`, StartPattern: `"start": "([^"]+)"`, WithinSec: 2},
+		Expectation{Kind: KindUnique, Header: "idempotency-key"},
+		Expectation{Kind: KindAbsent, Match: `"artist": "C"`},
+	)
+	if report := sink.Report(); !report.Passed {
+		t.Errorf("report:\n%s", report)
+	}
+
+	// failed expectations and query api
+	sink.Expect(Expectation{Name: "late", Kind: KindWithin, At: start.Add(-time.Minute), WithinSec: 2})
+	rec := httptest.NewRecorder()
+	sink.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, API_PREFIX+"report", nil))
+	var report Report
+	json.NewDecoder(rec.Body).Decode(&report)
+	if rec.Code != http.StatusExpectationFailed || report.Passed || !strings.Contains(report.Results[0].Detail, "arrived") {
+		t.Errorf("report: got %d %+v", rec.Code, report)
+	}
+
+	rec = httptest.NewRecorder()
+	sink.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, API_PREFIX+"requests?contains=B", nil))
+	var requests []Request
+	json.NewDecoder(rec.Body).Decode(&requests)
+	if len(requests) != 1 || requests[0].Path != "/meta" || requests[0].Method != http.MethodPost {
+		t.Errorf("requests: got %+v", requests)
+	}
+}
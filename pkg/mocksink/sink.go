@@ -0,0 +1,170 @@
+package mocksink
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+)
+
+// API_PREFIX is the path of the query api, all other paths are recorded.
+const API_PREFIX string = "/_mock/"
+
+// Request is a recorded metadata request.
+type Request struct {
+	Time    time.Time         `json:"time"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// Sink records every request and answers with status. Expectations are
+// checked against the recorded requests.
+type Sink struct {
+	mu           sync.Mutex
+	status       int
+	requests     []Request
+	expectations []Expectation
+	received     chan struct{}
+}
+
+func New() *Sink {
+	return &Sink{status: http.StatusOK, received: make(chan struct{}, 1)}
+}
+
+// SetStatus sets the response status of recorded requests.
+func (s *Sink) SetStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Expect sets the expectations of Report.
+func (s *Sink) Expect(expectations ...Expectation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expectations = expectations
+}
+
+// Requests returns all recorded requests in order of arrival.
+func (s *Sink) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Reset drops all recorded requests.
+func (s *Sink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// Wait blocks until n requests are recorded or timeout. It returns false on
+// timeout.
+func (s *Sink) Wait(n int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		if len(s.Requests()) >= n {
+			return true
+		}
+		select {
+		case <-s.received:
+		case <-deadline.C:
+			return len(s.Requests()) >= n
+		}
+	}
+}
+
+// Report checks the expectations.
+func (s *Sink) Report() Report {
+	s.mu.Lock()
+	expectations := s.expectations
+	s.mu.Unlock()
+	return Check(s.Requests(), expectations)
+}
+
+// ServeHTTP serves the query api under API_PREFIX and records all other
+// requests:
+//
+//	GET    /_mock/requests   recorded requests, filter by ?contains=
+//	DELETE /_mock/requests   drop recorded requests
+//	GET    /_mock/report     check expectations, 417 if failed
+//	PUT    /_mock/expectations
+func (s *Sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, API_PREFIX) {
+		s.record(w, r)
+		return
+	}
+
+	switch r.Method + " " + strings.TrimPrefix(r.URL.Path, API_PREFIX) {
+	case "GET requests":
+		contains := r.URL.Query().Get("contains")
+		requests := []Request{}
+		for _, request := range s.Requests() {
+			if strings.Contains(request.Body, contains) {
+				requests = append(requests, request)
+			}
+		}
+		writeJson(w, http.StatusOK, requests)
+	case "DELETE requests":
+		s.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	case "GET report":
+		report := s.Report()
+		status := http.StatusOK
+		if !report.Passed {
+			status = http.StatusExpectationFailed
+		}
+		writeJson(w, status, report)
+	case "PUT expectations":
+		var expectations []Expectation
+		if err := json.NewDecoder(r.Body).Decode(&expectations); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.Expect(expectations...)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Sink) record(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	headers := map[string]string{}
+	for name := range r.Header {
+		headers[name] = r.Header.Get(name)
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Time: now, Method: r.Method, Path: r.URL.Path, Headers: headers, Body: string(body)})
+	status := s.status
+	s.mu.Unlock()
+	select {
+	case s.received <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(status)
+}
+
+// helper
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Err(err, "write response")
+	}
+}
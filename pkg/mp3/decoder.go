@@ -0,0 +1,534 @@
+package mp3
+
+import (
+	"errors"
+)
+
+const (
+	GRANULE_SIZE   int = 576
+	SUBBANDS       int = 32
+	SUBBAND_SIZE   int = 18
+	RESERVOIR_SIZE int = 2048
+)
+
+var (
+	ErrUnsupportedLayer = errors.New("only layer 3 is decoded")
+	ErrFrameTooShort    = errors.New("frame too short")
+)
+
+// Decoder decodes layer 3 frames to pcm. The bit reservoir and the filter
+// bank are kept between frames, so frames have to be decoded in stream order.
+type Decoder struct {
+	version    Version
+	sampleRate int
+	channels   int
+
+	reservoir []byte
+	overlap   [2][SUBBANDS][SUBBAND_SIZE]float64
+	synth     [2]synthesis
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// Reset drops the reservoir and filter state, e.g. after an interruption.
+func (d *Decoder) Reset() {
+	*d = Decoder{}
+}
+
+// Decode returns the samples of frame by channel, in [-1, 1]. Frames whose
+// main data starts in a frame not seen yet, e.g. the first frames after
+// Reset, decode to silence.
+func (d *Decoder) Decode(frame []byte) ([][]float32, error) {
+	header, err := ParseHeader(frame)
+	if err != nil {
+		return nil, err
+	}
+	if header.Layer != 3 {
+		return nil, ErrUnsupportedLayer
+	}
+	if len(frame) < header.FrameSize {
+		return nil, ErrFrameTooShort
+	}
+	if header.Version != d.version || header.SampleRate != d.sampleRate || header.Channels() != d.channels {
+		d.Reset()
+		d.version, d.sampleRate, d.channels = header.Version, header.SampleRate, header.Channels()
+	}
+
+	offset := HEADER_SIZE
+	if header.Protected {
+		offset += 2
+	}
+	size := sideInfoSize(header)
+	if offset+size > header.FrameSize {
+		return nil, ErrFrameTooShort
+	}
+	side := parseSideInfo(frame[offset:offset+size], header)
+	mainData := frame[offset+size : header.FrameSize]
+
+	pcm := make([][]float32, d.channels)
+	for ch := range pcm {
+		pcm[ch] = make([]float32, header.Samples)
+	}
+	if side.mainDataBegin > len(d.reservoir) {
+		d.store(mainData)
+		return pcm, nil
+	}
+	data := make([]byte, 0, side.mainDataBegin+len(mainData))
+	data = append(data, d.reservoir[len(d.reservoir)-side.mainDataBegin:]...)
+	data = append(data, mainData...)
+	d.store(mainData)
+
+	bands := scaleFactorBands[header.Version][sampleRateIndex(header)]
+	r := &bitReader{data: data}
+	var scaleFactors [2]scaleFactors
+	for gr := 0; gr < side.granules; gr++ {
+		var spectrum [2][GRANULE_SIZE]float64
+		var nonZero [2]int
+		for ch := 0; ch < d.channels; ch++ {
+			g := &side.granule[gr][ch]
+			start := r.pos
+			if header.Version == Version1 {
+				scaleFactors[ch] = readScaleFactors(r, g, side.scfsi[ch], gr, scaleFactors[ch])
+			} else {
+				intensity := ch == 1 && header.ChannelMode == ChannelModeJointStereo && header.ModeExt&1 != 0
+				scaleFactors[ch] = readScaleFactorsLsf(r, g, intensity)
+			}
+			var values [GRANULE_SIZE]int
+			nonZero[ch] = readHuffman(r, g, &bands, header, start+g.part23Length, &values)
+			r.pos = start + g.part23Length
+			requantize(&values, g, &scaleFactors[ch], &bands, &spectrum[ch])
+		}
+
+		if header.ChannelMode == ChannelModeJointStereo && d.channels == 2 {
+			stereo(&spectrum, nonZero, &side.granule[gr][1], &scaleFactors[1], &bands, header)
+		}
+
+		for ch := 0; ch < d.channels; ch++ {
+			g := &side.granule[gr][ch]
+			reorder(&spectrum[ch], g, &bands)
+			antialias(&spectrum[ch], g)
+			samples := d.hybrid(&spectrum[ch], g, ch)
+			d.synth[ch].run(samples, pcm[ch][gr*GRANULE_SIZE:])
+		}
+	}
+	return pcm, nil
+}
+
+func (d *Decoder) store(mainData []byte) {
+	d.reservoir = append(d.reservoir, mainData...)
+	if len(d.reservoir) > RESERVOIR_SIZE {
+		d.reservoir = append(d.reservoir[:0], d.reservoir[len(d.reservoir)-RESERVOIR_SIZE:]...)
+	}
+}
+
+func sampleRateIndex(header Header) int {
+	for index, rate := range sampleRates[header.Version] {
+		if rate == header.SampleRate {
+			return index
+		}
+	}
+	return 0
+}
+
+// side info
+
+type granuleInfo struct {
+	part23Length      int
+	bigValues         int
+	globalGain        int
+	scalefacCompress  int
+	windowSwitching   bool
+	blockType         int
+	mixed             bool
+	tableSelect       [3]int
+	subblockGain      [3]int
+	region1Start      int
+	region2Start      int
+	preflag           bool
+	scalefacScale     bool
+	count1TableSelect int
+	intensityScale    int
+}
+
+type sideInfo struct {
+	mainDataBegin int
+	granules      int
+	scfsi         [2][4]bool
+	granule       [2][2]granuleInfo
+}
+
+func sideInfoSize(header Header) int {
+	mono := header.ChannelMode == ChannelModeMono
+	switch {
+	case header.Version == Version1 && mono:
+		return 17
+	case header.Version == Version1:
+		return 32
+	case mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+func parseSideInfo(data []byte, header Header) sideInfo {
+	r := &bitReader{data: data}
+	channels := header.Channels()
+	side := sideInfo{granules: 1}
+	if header.Version == Version1 {
+		side.granules = 2
+		side.mainDataBegin = r.read(9)
+		if channels == 1 {
+			r.read(5)
+		} else {
+			r.read(3)
+		}
+		for ch := 0; ch < channels; ch++ {
+			for band := 0; band < 4; band++ {
+				side.scfsi[ch][band] = r.read(1) == 1
+			}
+		}
+	} else {
+		side.mainDataBegin = r.read(8)
+		r.read(channels)
+	}
+
+	bands := scaleFactorBands[header.Version][sampleRateIndex(header)]
+	for gr := 0; gr < side.granules; gr++ {
+		for ch := 0; ch < channels; ch++ {
+			g := &side.granule[gr][ch]
+			g.part23Length = r.read(12)
+			g.bigValues = min(r.read(9), GRANULE_SIZE/2)
+			g.globalGain = r.read(8)
+			if header.Version == Version1 {
+				g.scalefacCompress = r.read(4)
+			} else {
+				g.scalefacCompress = r.read(9)
+			}
+			g.windowSwitching = r.read(1) == 1
+			if g.windowSwitching {
+				g.blockType = r.read(2)
+				g.mixed = r.read(1) == 1
+				for i := 0; i < 2; i++ {
+					g.tableSelect[i] = r.read(5)
+				}
+				for i := 0; i < 3; i++ {
+					g.subblockGain[i] = r.read(3)
+				}
+				g.region1Start = bands.long[8]
+				if g.blockType == 2 {
+					g.region1Start = 36
+					if header.SampleRate == 8000 {
+						g.region1Start = 72
+					}
+				}
+				g.region2Start = GRANULE_SIZE
+			} else {
+				for i := 0; i < 3; i++ {
+					g.tableSelect[i] = r.read(5)
+				}
+				region0Count := r.read(4)
+				region1Count := r.read(3)
+				g.region1Start = bands.long[min(region0Count+1, 22)]
+				g.region2Start = bands.long[min(region0Count+region1Count+2, 22)]
+			}
+			if header.Version == Version1 {
+				g.preflag = r.read(1) == 1
+			}
+			g.scalefacScale = r.read(1) == 1
+			g.count1TableSelect = r.read(1)
+		}
+	}
+	return side
+}
+
+// scale factors
+
+type scaleFactors struct {
+	long  [22]int
+	short [13][3]int
+	// illegal intensity positions by band
+	longMax  [22]int
+	shortMax [13]int
+}
+
+func (g *granuleInfo) short() bool {
+	return g.windowSwitching && g.blockType == 2
+}
+
+func readScaleFactors(r *bitReader, g *granuleInfo, scfsi [4]bool, gr int, previous scaleFactors) scaleFactors {
+	slen1, slen2 := slen[0][g.scalefacCompress], slen[1][g.scalefacCompress]
+	sf := scaleFactors{}
+	for i := range sf.longMax {
+		sf.longMax[i] = 7
+	}
+	for i := range sf.shortMax {
+		sf.shortMax[i] = 7
+	}
+
+	if g.short() {
+		sfb := 0
+		if g.mixed {
+			for ; sfb < 8; sfb++ {
+				sf.long[sfb] = r.read(slen1)
+			}
+			sfb = 3
+		}
+		for ; sfb < 12; sfb++ {
+			bits := slen1
+			if sfb >= 6 {
+				bits = slen2
+			}
+			for w := 0; w < 3; w++ {
+				sf.short[sfb][w] = r.read(bits)
+			}
+		}
+		return sf
+	}
+
+	groups := [5]int{0, 6, 11, 16, 21}
+	for group := 0; group < 4; group++ {
+		bits := slen1
+		if group >= 2 {
+			bits = slen2
+		}
+		for sfb := groups[group]; sfb < groups[group+1]; sfb++ {
+			if gr == 1 && scfsi[group] {
+				sf.long[sfb] = previous.long[sfb]
+			} else {
+				sf.long[sfb] = r.read(bits)
+			}
+		}
+	}
+	return sf
+}
+
+// readScaleFactorsLsf reads mpeg 2 scale factors. intensity is set for the
+// right channel of intensity stereo.
+func readScaleFactorsLsf(r *bitReader, g *granuleInfo, intensity bool) scaleFactors {
+	var lengths [4]int
+	row := 0
+	sfc := g.scalefacCompress
+	if intensity {
+		g.intensityScale = sfc & 1
+		sfc >>= 1
+		switch {
+		case sfc < 180:
+			lengths = [4]int{sfc / 36, (sfc % 36) / 6, sfc % 36 % 6, 0}
+			row = 3
+		case sfc < 244:
+			sfc -= 180
+			lengths = [4]int{(sfc % 64) >> 4, (sfc % 16) >> 2, sfc % 4, 0}
+			row = 4
+		default:
+			sfc -= 244
+			lengths = [4]int{sfc / 3, sfc % 3, 0, 0}
+			row = 5
+		}
+	} else {
+		switch {
+		case sfc < 400:
+			lengths = [4]int{(sfc >> 4) / 5, (sfc >> 4) % 5, (sfc % 16) >> 2, sfc % 4}
+		case sfc < 500:
+			sfc -= 400
+			lengths = [4]int{(sfc >> 2) / 5, (sfc >> 2) % 5, sfc % 4, 0}
+			row = 1
+		default:
+			sfc -= 500
+			lengths = [4]int{sfc / 3, sfc % 3, 0, 0}
+			row = 2
+			g.preflag = true
+		}
+	}
+
+	kind := 0
+	if g.short() {
+		kind = 1
+		if g.mixed {
+			kind = 2
+		}
+	}
+	partitions := scaleFactorPartitions[row][kind]
+
+	sf := scaleFactors{}
+	longSfb, shortSfb, window := 0, 0, 0
+	if kind == 2 {
+		shortSfb = 3
+	}
+	for part, count := range partitions {
+		bits := lengths[part]
+		for i := 0; i < count; i++ {
+			value := r.read(bits)
+			max := 1<<bits - 1
+			if kind == 0 || (kind == 2 && part == 0 && i < 6) {
+				if longSfb < 22 {
+					sf.long[longSfb] = value
+					sf.longMax[longSfb] = max
+				}
+				longSfb++
+				continue
+			}
+			if shortSfb < 13 {
+				sf.short[shortSfb][window] = value
+				sf.shortMax[shortSfb] = max
+			}
+			window++
+			if window == 3 {
+				window = 0
+				shortSfb++
+			}
+		}
+	}
+	// bands without scale factors continue the last band
+	for sfb := max(longSfb, 1); sfb < 22; sfb++ {
+		sf.longMax[sfb] = sf.longMax[sfb-1]
+	}
+	for sfb := max(shortSfb, 1); sfb < 13; sfb++ {
+		sf.shortMax[sfb] = sf.shortMax[sfb-1]
+	}
+	return sf
+}
+
+// huffman
+
+// readHuffman decodes the spectral values of a granule up to bit end and
+// returns the number of lines up to the last non zero value.
+func readHuffman(r *bitReader, g *granuleInfo, bands *bands, header Header, end int, values *[GRANULE_SIZE]int) int {
+	bigValues := g.bigValues * 2
+	region1 := min(g.region1Start, bigValues)
+	region2 := min(g.region2Start, bigValues)
+
+	i := 0
+	for region, limit := range [3]int{region1, region2, bigValues} {
+		table := g.tableSelect[region]
+		tree := huffmanTrees[table]
+		bits := linbits[table]
+		for ; i < limit; i += 2 {
+			if tree == nil {
+				values[i], values[i+1] = 0, 0
+				continue
+			}
+			xy := tree.decode(r)
+			x, y := xy/tree.size, xy%tree.size
+			values[i] = readValue(r, x, bits)
+			values[i+1] = readValue(r, y, bits)
+		}
+	}
+
+	// count1 region of quadruples of -1, 0 or 1
+	quad := &quadTrees[g.count1TableSelect]
+	for i+4 <= GRANULE_SIZE && r.pos < end {
+		vwxy := quad.decode(r)
+		for bit := 3; bit >= 0; bit-- {
+			values[i] = readValue(r, vwxy>>bit&1, 0)
+			i++
+		}
+		if r.pos > end {
+			// the last quadruple is not part of the granule
+			i -= 4
+			for j := i; j < i+4; j++ {
+				values[j] = 0
+			}
+			break
+		}
+	}
+	for j := i; j < GRANULE_SIZE; j++ {
+		values[j] = 0
+	}
+
+	for i > 0 && values[i-1] == 0 {
+		i--
+	}
+	return i
+}
+
+func readValue(r *bitReader, value int, bits int) int {
+	if bits > 0 && value == 15 {
+		value += r.read(bits)
+	}
+	if value != 0 && r.read(1) == 1 {
+		return -value
+	}
+	return value
+}
+
+// huffmanTree decodes one code bit by bit. Leaves are stored as -(value+1).
+type huffmanTree struct {
+	size  int
+	nodes [][2]int
+}
+
+func newHuffmanTree(table huffmanTable) *huffmanTree {
+	t := &huffmanTree{size: table.size, nodes: [][2]int{{}}}
+	for value, code := range table.codes {
+		node := 0
+		for bit := int(table.bits[value]) - 1; bit >= 0; bit-- {
+			b := int(code) >> bit & 1
+			if bit == 0 {
+				t.nodes[node][b] = -(value + 1)
+				break
+			}
+			if t.nodes[node][b] == 0 {
+				t.nodes = append(t.nodes, [2]int{})
+				t.nodes[node][b] = len(t.nodes) - 1
+			}
+			node = t.nodes[node][b]
+		}
+	}
+	return t
+}
+
+func (t *huffmanTree) decode(r *bitReader) int {
+	node := 0
+	for {
+		next := t.nodes[node][r.read(1)]
+		if next < 0 {
+			return -next - 1
+		}
+		if next == 0 {
+			// incomplete code, only on corrupt data
+			return 0
+		}
+		node = next
+	}
+}
+
+var huffmanTrees, quadTrees = func() ([32]*huffmanTree, [2]huffmanTree) {
+	var trees [32]*huffmanTree
+	for table := range trees {
+		base := table
+		switch {
+		case table >= 24:
+			base = 24
+		case table >= 16:
+			base = 16
+		}
+		if t, ok := huffmanTables[base]; ok {
+			trees[table] = newHuffmanTree(t)
+		}
+	}
+	return trees, [2]huffmanTree{*newHuffmanTree(quadTables[0]), *newHuffmanTree(quadTables[1])}
+}()
+
+// bit reader
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+// read returns the next n bits, bits after the end of data are 0.
+func (r *bitReader) read(n int) int {
+	value := 0
+	for i := 0; i < n; i++ {
+		bit := 0
+		if r.pos>>3 < len(r.data) {
+			bit = int(r.data[r.pos>>3]>>(7-r.pos&7)) & 1
+		}
+		value = value<<1 | bit
+		r.pos++
+	}
+	return value
+}
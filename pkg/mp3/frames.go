@@ -0,0 +1,110 @@
+package mp3
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/nice-pink/streamey/pkg/util"
+)
+
+const (
+	ID3_HEADER_SIZE int = 10
+	READ_BUFFER     int = 16 * 1024
+)
+
+type Frame struct {
+	Offset int
+	Header Header
+}
+
+func (f Frame) End() int {
+	return f.Offset + f.Header.FrameSize
+}
+
+// Frames returns all mpeg audio frames found in data. Leading id3 tags and
+// garbage between frames are skipped.
+func Frames(data []byte) []Frame {
+	frames := []Frame{}
+	index := id3Size(data)
+	for index+HEADER_SIZE <= len(data) {
+		header, err := ParseHeader(data[index:])
+		if err != nil || index+header.FrameSize > len(data) {
+			index++
+			continue
+		}
+		// verify next frame, if there is one
+		next := index + header.FrameSize
+		if next+HEADER_SIZE <= len(data) {
+			nextHeader, err := ParseHeader(data[next:])
+			if err != nil || !header.sameStream(nextHeader) {
+				index++
+				continue
+			}
+		}
+		frames = append(frames, Frame{Offset: index, Header: header})
+		index = next
+	}
+	return frames
+}
+
+func id3Size(data []byte) int {
+	if len(data) < ID3_HEADER_SIZE || string(data[:3]) != "ID3" {
+		return 0
+	}
+	size := int(util.Unsynchsafe(binary.BigEndian.Uint32(data[6:10]))) + ID3_HEADER_SIZE
+	// footer
+	if data[5]&0x10 != 0 {
+		size += ID3_HEADER_SIZE
+	}
+	return min(size, len(data))
+}
+
+// reader
+
+type FrameReader struct {
+	reader  *bufio.Reader
+	Skipped int64
+}
+
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{reader: bufio.NewReaderSize(r, READ_BUFFER)}
+}
+
+// Next returns the next frame of the stream. Bytes which don't belong to a
+// frame are skipped and counted.
+func (r *FrameReader) Next() ([]byte, Header, error) {
+	for {
+		data, err := r.reader.Peek(HEADER_SIZE)
+		if err != nil {
+			return nil, Header{}, err
+		}
+		header, err := ParseHeader(data)
+		if err != nil {
+			r.skip(1)
+			continue
+		}
+
+		// verify next header, if already available
+		data, err = r.reader.Peek(header.FrameSize + HEADER_SIZE)
+		if err == nil {
+			nextHeader, err := ParseHeader(data[header.FrameSize:])
+			if err != nil || !header.sameStream(nextHeader) {
+				r.skip(1)
+				continue
+			}
+		}
+
+		frame := make([]byte, header.FrameSize)
+		_, err = io.ReadFull(r.reader, frame)
+		if err != nil {
+			return nil, Header{}, err
+		}
+		return frame, header, nil
+	}
+}
+
+func (r *FrameReader) skip(n int) {
+	skipped, _ := r.reader.Discard(n)
+	r.Skipped += int64(skipped)
+}
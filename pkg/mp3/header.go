@@ -0,0 +1,158 @@
+package mp3
+
+import (
+	"errors"
+	"time"
+)
+
+const HEADER_SIZE int = 4
+
+type Version int
+
+const (
+	Version25 Version = iota
+	VersionReserved
+	Version2
+	Version1
+)
+
+type ChannelMode int
+
+const (
+	ChannelModeStereo ChannelMode = iota
+	ChannelModeJointStereo
+	ChannelModeDualChannel
+	ChannelModeMono
+)
+
+var (
+	ErrNoSync         = errors.New("no frame sync")
+	ErrInvalidHeader  = errors.New("invalid frame header")
+	ErrFreeFormat     = errors.New("free format bitrate not supported")
+	ErrHeaderTooShort = errors.New("header too short")
+)
+
+// kbit/s by layer and bitrate index
+var bitratesV1 = [3][15]int{
+	{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+}
+
+var bitratesV2 = [3][15]int{
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// hz by version and sample rate index
+var sampleRates = [4][3]int{{11025, 12000, 8000}, {}, {22050, 24000, 16000}, {44100, 48000, 32000}}
+
+const (
+	privateBitByte   int = 2
+	copyrightBitByte int = 3
+)
+
+type Header struct {
+	Version     Version
+	Layer       int
+	Protected   bool
+	Bitrate     int
+	SampleRate  int
+	Padding     bool
+	Private     bool
+	ChannelMode ChannelMode
+	ModeExt     int
+	Copyright   bool
+	FrameSize   int
+	Samples     int
+}
+
+// ParseHeader parses the 4 byte mpeg audio frame header at the start of data.
+func ParseHeader(data []byte) (Header, error) {
+	if len(data) < HEADER_SIZE {
+		return Header{}, ErrHeaderTooShort
+	}
+	if data[0] != 0xFF || data[1]&0xE0 != 0xE0 {
+		return Header{}, ErrNoSync
+	}
+
+	h := Header{}
+	h.Version = Version((data[1] >> 3) & 0x03)
+	layerBits := int((data[1] >> 1) & 0x03)
+	bitrateIndex := int(data[2] >> 4)
+	sampleRateIndex := int((data[2] >> 2) & 0x03)
+	if h.Version == VersionReserved || layerBits == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return Header{}, ErrInvalidHeader
+	}
+	if bitrateIndex == 0 {
+		return Header{}, ErrFreeFormat
+	}
+
+	h.Layer = 4 - layerBits
+	h.Protected = data[1]&0x01 == 0
+	if h.Version == Version1 {
+		h.Bitrate = bitratesV1[h.Layer-1][bitrateIndex] * 1000
+	} else {
+		h.Bitrate = bitratesV2[h.Layer-1][bitrateIndex] * 1000
+	}
+	h.SampleRate = sampleRates[h.Version][sampleRateIndex]
+	h.Padding = data[2]&0x02 != 0
+	h.Private = data[privateBitByte]&0x01 != 0
+	h.ChannelMode = ChannelMode(data[3] >> 6)
+	h.ModeExt = int((data[3] >> 4) & 0x03)
+	h.Copyright = data[copyrightBitByte]&0x08 != 0
+
+	padding := 0
+	if h.Padding {
+		padding = 1
+	}
+	switch h.Layer {
+	case 1:
+		h.Samples = 384
+		h.FrameSize = (12*h.Bitrate/h.SampleRate + padding) * 4
+	case 2:
+		h.Samples = 1152
+		h.FrameSize = 144*h.Bitrate/h.SampleRate + padding
+	case 3:
+		if h.Version == Version1 {
+			h.Samples = 1152
+			h.FrameSize = 144*h.Bitrate/h.SampleRate + padding
+		} else {
+			h.Samples = 576
+			h.FrameSize = 72*h.Bitrate/h.SampleRate + padding
+		}
+	}
+	return h, nil
+}
+
+func (h Header) Channels() int {
+	if h.ChannelMode == ChannelModeMono {
+		return 1
+	}
+	return 2
+}
+
+func (h Header) Duration() time.Duration {
+	return time.Duration(h.Samples) * time.Second / time.Duration(h.SampleRate)
+}
+
+// sameStream checks if both headers can belong to the same stream.
+func (h Header) sameStream(other Header) bool {
+	return h.Version == other.Version && h.Layer == other.Layer && h.SampleRate == other.SampleRate
+}
+
+// copyright bit
+
+// SetCopyright sets or clears the copyright bit in the header at the start of
+// frame. Latency markers use it, so the private bit stays intact.
+func SetCopyright(frame []byte, copyright bool) {
+	if len(frame) < HEADER_SIZE {
+		return
+	}
+	if copyright {
+		frame[copyrightBitByte] |= 0x08
+	} else {
+		frame[copyrightBitByte] &^= 0x08
+	}
+}
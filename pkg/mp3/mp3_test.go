@@ -0,0 +1,258 @@
+package mp3
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseHeader(t *testing.T) {
+	// mpeg 1 layer 3, 128kbit/s, 44.1kHz, private, joint stereo
+	header, err := ParseHeader([]byte{0xFF, 0xFB, 0x91, 0x64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != Version1 || header.Layer != 3 {
+		t.Errorf("version/layer: got %v/%d", header.Version, header.Layer)
+	}
+	if header.Bitrate != 128000 || header.SampleRate != 44100 {
+		t.Errorf("bitrate/sample rate: got %d/%d", header.Bitrate, header.SampleRate)
+	}
+	if header.FrameSize != 417 || header.Samples != 1152 {
+		t.Errorf("frame size/samples: got %d/%d", header.FrameSize, header.Samples)
+	}
+	if !header.Private || header.ChannelMode != ChannelModeJointStereo {
+		t.Errorf("private/mode: got %v/%v", header.Private, header.ChannelMode)
+	}
+
+	// the copyright bit leaves the private bit alone
+	frame := []byte{0xFF, 0xFB, 0x91, 0x64}
+	SetCopyright(frame, true)
+	if header, _ = ParseHeader(frame); !header.Copyright || !header.Private {
+		t.Errorf("copyright/private: got %v/%v", header.Copyright, header.Private)
+	}
+	SetCopyright(frame, false)
+	if header, _ = ParseHeader(frame); header.Copyright || !header.Private {
+		t.Errorf("copyright/private: got %v/%v", header.Copyright, header.Private)
+	}
+
+	if _, err := ParseHeader([]byte{0x49, 0x44, 0x33, 0x03}); err != ErrNoSync {
+		t.Errorf("no sync: got %v", err)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x64})
+	id3 := []byte("ID3\x03\x00\x00\x00\x00\x00\x05hello")
+	data := append(id3, bytes.Repeat(frame, 5)...)
+
+	frames := Frames(data)
+	if len(frames) != 5 {
+		t.Fatalf("frames: got %d != want %d", len(frames), 5)
+	}
+	if frames[0].Offset != len(id3) {
+		t.Errorf("offset: got %d != want %d", frames[0].Offset, len(id3))
+	}
+
+	reader := NewFrameReader(bytes.NewReader(data))
+	count := 0
+	for {
+		if _, _, err := reader.Next(); err != nil {
+			break
+		}
+		count++
+	}
+	if count != 5 || reader.Skipped != int64(len(id3)) {
+		t.Errorf("reader: got %d frames, %d skipped", count, reader.Skipped)
+	}
+}
+
+func TestSilentFrames(t *testing.T) {
+	data, err := SilentFrames(128000, 44100, false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := Frames(data)
+	// 44100 / 1152 = 38.3
+	if len(frames) != 39 || frames[len(frames)-1].End() != len(data) {
+		t.Errorf("frames: got %d, end %d != %d", len(frames), frames[len(frames)-1].End(), len(data))
+	}
+	// bitrate is met exactly by padding
+	duration := time.Duration(len(frames)) * frames[0].Header.Duration()
+	bitrate := float64(len(data)*8) / duration.Seconds()
+	if bitrate < 127900 || bitrate > 128100 {
+		t.Errorf("bitrate: got %f", bitrate)
+	}
+
+	if _, err := SilentFrames(100000, 44100, false, time.Second); err != ErrUnsupportedFormat {
+		t.Errorf("bitrate: got %v", err)
+	}
+}
+
+func TestDecodeSilence(t *testing.T) {
+	data, err := SilentFrames(128000, 44100, false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder()
+	for _, frame := range Frames(data) {
+		pcm, err := d.Decode(data[frame.Offset:frame.End()])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pcm) != 2 || len(pcm[0]) != 1152 {
+			t.Fatalf("pcm: got %d channels, %d samples", len(pcm), len(pcm[0]))
+		}
+		for _, sample := range pcm[1] {
+			if sample != 0 {
+				t.Fatalf("sample: got %f", sample)
+			}
+		}
+	}
+}
+
+func TestDecodeTone(t *testing.T) {
+	// mono frames with a single spectral line, a sine of amplitude 0.25
+	frame := toneFrame(20, 202)
+	d := NewDecoder()
+	var pcm [][]float32
+	for i := 0; i < 4; i++ {
+		var err error
+		if pcm, err = d.Decode(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sum, crossings := 0.0, 0
+	for i, sample := range pcm[0] {
+		sum += float64(sample) * float64(sample)
+		if i > 0 && (sample < 0) != (pcm[0][i-1] < 0) {
+			crossings++
+		}
+	}
+	// (20 + 0.5) / 1152 cycles per sample
+	if rms := math.Sqrt(sum / 1152); math.Abs(rms-0.25/math.Sqrt2) > 0.01 {
+		t.Errorf("rms: got %f", rms)
+	}
+	if crossings < 40 || crossings > 42 {
+		t.Errorf("zero crossings: got %d", crossings)
+	}
+
+	if _, err := d.Decode([]byte{0xFF, 0xFD, 0x90, 0xC0}); err != ErrUnsupportedLayer {
+		t.Errorf("layer 2: got %v", err)
+	}
+}
+
+func TestDecodeEncoded(t *testing.T) {
+	tests := []struct {
+		file     string
+		from, to int     // frames to measure
+		rms      float64 // dB of every channel
+	}{
+		// 1 kHz at -20 dBFS, joint stereo with mid/side, without encoder
+		// delay and padding
+		{"tone.mp3", 4, 37, -23.01},
+		// mpeg 2 mono with short blocks, rms of go-mp3
+		{"speech.mp3", 0, 80, -22.52},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			frames := Frames(data)
+			if len(frames) < test.to {
+				t.Fatalf("frames: got %d, want %d", len(frames), test.to)
+			}
+			d := NewDecoder()
+			var sums []float64
+			samples := 0
+			for i, frame := range frames[:test.to] {
+				pcm, err := d.Decode(data[frame.Offset:frame.End()])
+				if err != nil {
+					t.Fatalf("frame %d: %v", i, err)
+				}
+				if i < test.from {
+					continue
+				}
+				if sums == nil {
+					sums = make([]float64, len(pcm))
+				}
+				for c := range pcm {
+					for _, sample := range pcm[c] {
+						sums[c] += float64(sample) * float64(sample)
+					}
+				}
+				samples += len(pcm[0])
+			}
+			for c, sum := range sums {
+				rms := 20 * math.Log10(math.Sqrt(sum/float64(samples)))
+				if math.Abs(rms-test.rms) > 0.5 {
+					t.Errorf("channel %d rms: got %.2f dB, want %.2f dB", c, rms, test.rms)
+				}
+			}
+		})
+	}
+}
+
+// toneFrame returns a mpeg 1 mono frame, 128kbit/s, 44.1kHz, whose granules
+// have value 1 at spectral line, which is even, and no scale factors.
+func toneFrame(line int, globalGain int) []byte {
+	table := huffmanTables[1]
+	granule := func(w *bitWriter) {
+		for i := 0; i < line; i += 2 {
+			w.write(int(table.codes[0]), int(table.bits[0]))
+		}
+		// x = 1, y = 0 and the sign of x
+		w.write(int(table.codes[table.size]), int(table.bits[table.size]))
+		w.write(0, 1)
+	}
+	main := &bitWriter{}
+	granule(main)
+	part23 := main.bits
+	granule(main)
+
+	side := &bitWriter{}
+	side.write(0, 9) // main data begin
+	side.write(0, 5)
+	side.write(0, 4)
+	for gr := 0; gr < 2; gr++ {
+		side.write(part23, 12)
+		side.write(line/2+1, 9)
+		side.write(globalGain, 8)
+		side.write(0, 4) // scalefac compress
+		side.write(0, 1) // window switching
+		side.write(1, 5)
+		side.write(0, 5)
+		side.write(0, 5)
+		side.write(5, 4) // region 1 starts at line 24
+		side.write(0, 3)
+		side.write(0, 3)
+	}
+
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0xC0})
+	copy(frame[4:], side.data)
+	copy(frame[4+17:], main.data)
+	return frame
+}
+
+type bitWriter struct {
+	data []byte
+	bits int
+}
+
+func (w *bitWriter) write(value int, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(value>>i&1) << (7 - w.bits%8)
+		w.bits++
+	}
+}
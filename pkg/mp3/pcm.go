@@ -0,0 +1,44 @@
+package mp3
+
+import (
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+)
+
+// PcmConsumer gets decoded samples by channel.
+type PcmConsumer interface {
+	Push(pcm [][]float32, sampleRate int)
+	// Reset is called when the stream was interrupted.
+	Reset()
+}
+
+// PcmHandler decodes received frames and pushes their samples to a consumer.
+// It is a frame handler of package receiver.
+type PcmHandler struct {
+	decoder  *Decoder
+	consumer PcmConsumer
+	logged   error
+}
+
+func NewPcmHandler(consumer PcmConsumer) *PcmHandler {
+	return &PcmHandler{decoder: NewDecoder(), consumer: consumer}
+}
+
+func (h *PcmHandler) Frame(frame []byte, header Header, received time.Time) {
+	pcm, err := h.decoder.Decode(frame)
+	if err != nil {
+		// log every kind of error once
+		if err != h.logged {
+			log.Err(err, "cannot decode frame")
+			h.logged = err
+		}
+		return
+	}
+	h.consumer.Push(pcm, header.SampleRate)
+}
+
+func (h *PcmHandler) Reset() {
+	h.decoder.Reset()
+	h.consumer.Reset()
+}
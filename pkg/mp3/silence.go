@@ -0,0 +1,83 @@
+package mp3
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported bitrate or sample rate")
+
+// SilentFrames returns layer 3 frames of digital silence, covering at least
+// duration. Side info and main data are all zero, so every decoder outputs
+// silence. Padding is distributed like encoders do, to match bitrate exactly.
+func SilentFrames(bitrate int, sampleRate int, mono bool, duration time.Duration) ([]byte, error) {
+	version, sampleRateIndex, ok := findSampleRate(sampleRate)
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+	bitrateIndex, ok := findBitrate(version, bitrate)
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	header := []byte{
+		0xFF,
+		0xE0 | byte(version)<<3 | 0x01<<1 | 0x01, // layer 3, no crc
+		byte(bitrateIndex)<<4 | byte(sampleRateIndex)<<2,
+		0x00,
+	}
+	if mono {
+		header[3] = byte(ChannelModeMono) << 6
+	}
+	h, err := ParseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := int64(duration.Seconds() * float64(sampleRate))
+	count := int((samples + int64(h.Samples) - 1) / int64(h.Samples))
+	count = max(count, 1)
+
+	coefficient := h.Samples / 8
+	rest := 0
+	data := make([]byte, 0, count*(h.FrameSize+1))
+	for i := 0; i < count; i++ {
+		frame := make([]byte, h.FrameSize, h.FrameSize+1)
+		copy(frame, header)
+		rest += coefficient * h.Bitrate % sampleRate
+		if rest >= sampleRate {
+			rest -= sampleRate
+			frame[2] |= 0x02
+			frame = append(frame, 0)
+		}
+		data = append(data, frame...)
+	}
+	return data, nil
+}
+
+func findSampleRate(sampleRate int) (Version, int, bool) {
+	if sampleRate <= 0 {
+		return VersionReserved, 0, false
+	}
+	for version, rates := range sampleRates {
+		for index, rate := range rates {
+			if rate == sampleRate {
+				return Version(version), index, true
+			}
+		}
+	}
+	return VersionReserved, 0, false
+}
+
+func findBitrate(version Version, bitrate int) (int, bool) {
+	table := bitratesV2[2]
+	if version == Version1 {
+		table = bitratesV1[2]
+	}
+	for index, kbit := range table {
+		if index > 0 && kbit*1000 == bitrate {
+			return index, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,347 @@
+package mp3
+
+import (
+	"math"
+)
+
+// requantization
+
+const POW43_SIZE int = 8207
+
+var pow43 = func() [POW43_SIZE]float64 {
+	var table [POW43_SIZE]float64
+	for i := range table {
+		table[i] = math.Pow(float64(i), 4.0/3.0)
+	}
+	return table
+}()
+
+func requantizeValue(value int, exponent float64) float64 {
+	magnitude := value
+	if magnitude < 0 {
+		magnitude = -magnitude
+	}
+	var v float64
+	if magnitude < POW43_SIZE {
+		v = pow43[magnitude]
+	} else {
+		v = math.Pow(float64(magnitude), 4.0/3.0)
+	}
+	v *= math.Exp2(exponent)
+	if value < 0 {
+		return -v
+	}
+	return v
+}
+
+func requantize(values *[GRANULE_SIZE]int, g *granuleInfo, sf *scaleFactors, bands *bands, out *[GRANULE_SIZE]float64) {
+	gain := 0.25 * float64(g.globalGain-210)
+	shift := 0.5
+	if g.scalefacScale {
+		shift = 1
+	}
+
+	longEnd := GRANULE_SIZE
+	shortStart := 13
+	if g.short() {
+		longEnd, shortStart = 0, 0
+		if g.mixed {
+			longEnd, shortStart = bands.short[3]*3, 3
+		}
+	}
+
+	for sfb := 0; sfb < 22 && bands.long[sfb] < longEnd; sfb++ {
+		scale := sf.long[sfb]
+		if g.preflag {
+			scale += pretab[sfb]
+		}
+		exponent := gain - shift*float64(scale)
+		for i := bands.long[sfb]; i < bands.long[sfb+1] && i < longEnd; i++ {
+			out[i] = requantizeValue(values[i], exponent)
+		}
+	}
+
+	for sfb := shortStart; sfb < 13; sfb++ {
+		start, width := bands.short[sfb]*3, bands.short[sfb+1]-bands.short[sfb]
+		for w := 0; w < 3; w++ {
+			exponent := gain - 2*float64(g.subblockGain[w]) - shift*float64(sf.short[sfb][w])
+			for i := start + w*width; i < start+(w+1)*width; i++ {
+				out[i] = requantizeValue(values[i], exponent)
+			}
+		}
+	}
+}
+
+// stereo processing
+
+// stereo applies mid side and intensity stereo of joint stereo frames to
+// the spectrum in place.
+func stereo(spectrum *[2][GRANULE_SIZE]float64, nonZero [2]int, g *granuleInfo, sf *scaleFactors, bands *bands, header Header) {
+	midSide := header.ModeExt&2 != 0
+	intensity := header.ModeExt&1 != 0
+
+	// lines [start, end) with intensity position pos, max is illegal
+	band := func(start, end, pos, max int, isIntensity bool) {
+		if isIntensity && pos != max {
+			left, right := intensityRatios(pos, g.intensityScale, header.Version)
+			for i := start; i < end; i++ {
+				spectrum[1][i] = spectrum[0][i] * right
+				spectrum[0][i] *= left
+			}
+			return
+		}
+		if midSide {
+			for i := start; i < end; i++ {
+				mid, side := spectrum[0][i], spectrum[1][i]
+				spectrum[0][i] = (mid + side) * math.Sqrt2 / 2
+				spectrum[1][i] = (mid - side) * math.Sqrt2 / 2
+			}
+		}
+	}
+
+	if !g.short() {
+		for sfb := 0; sfb < 22; sfb++ {
+			pos, max := sf.long[sfb], sf.longMax[sfb]
+			if sfb == 21 {
+				pos, max = sf.long[20], sf.longMax[20]
+			}
+			start, end := bands.long[sfb], bands.long[sfb+1]
+			band(start, end, pos, max, intensity && start >= nonZero[1])
+		}
+		return
+	}
+
+	longEnd, shortStart := 0, 0
+	if g.mixed {
+		longEnd, shortStart = bands.short[3]*3, 3
+		band(0, longEnd, 0, 0, false)
+	}
+	// the intensity part starts after the last non zero line of each window
+	var windowEnd [3]int
+	for sfb := shortStart; sfb < 13; sfb++ {
+		start, width := bands.short[sfb]*3, bands.short[sfb+1]-bands.short[sfb]
+		for w := 0; w < 3; w++ {
+			for i := start + w*width; i < start+(w+1)*width; i++ {
+				if spectrum[1][i] != 0 {
+					windowEnd[w] = sfb + 1
+				}
+			}
+		}
+	}
+	for sfb := shortStart; sfb < 13; sfb++ {
+		start, width := bands.short[sfb]*3, bands.short[sfb+1]-bands.short[sfb]
+		for w := 0; w < 3; w++ {
+			pos, max := sf.short[sfb][w], sf.shortMax[sfb]
+			if sfb == 12 {
+				pos, max = sf.short[11][w], sf.shortMax[11]
+			}
+			band(start+w*width, start+(w+1)*width, pos, max, intensity && sfb >= windowEnd[w])
+		}
+	}
+}
+
+func intensityRatios(pos int, scale int, version Version) (float64, float64) {
+	if version == Version1 {
+		if pos == 6 {
+			return 1, 0
+		}
+		ratio := math.Tan(float64(pos) * math.Pi / 12)
+		return ratio / (1 + ratio), 1 / (1 + ratio)
+	}
+	io := math.Exp2(-0.25 * float64(scale+1))
+	switch {
+	case pos == 0:
+		return 1, 1
+	case pos%2 == 1:
+		return math.Pow(io, float64(pos+1)/2), 1
+	default:
+		return 1, math.Pow(io, float64(pos)/2)
+	}
+}
+
+// reorder sorts short block lines by subband instead of window.
+func reorder(spectrum *[GRANULE_SIZE]float64, g *granuleInfo, bands *bands) {
+	if !g.short() {
+		return
+	}
+	shortStart := 0
+	if g.mixed {
+		shortStart = 3
+	}
+	var tmp [GRANULE_SIZE]float64
+	for sfb := shortStart; sfb < 13; sfb++ {
+		start, width := bands.short[sfb]*3, bands.short[sfb+1]-bands.short[sfb]
+		for w := 0; w < 3; w++ {
+			for i := 0; i < width; i++ {
+				tmp[start+i*3+w] = spectrum[start+w*width+i]
+			}
+		}
+	}
+	first := bands.short[shortStart] * 3
+	copy(spectrum[first:], tmp[first:])
+}
+
+var antialiasCs, antialiasCa = func() ([8]float64, [8]float64) {
+	var cs, ca [8]float64
+	for i, c := range antialiasC {
+		norm := math.Sqrt(1 + c*c)
+		cs[i], ca[i] = 1/norm, c/norm
+	}
+	return cs, ca
+}()
+
+func antialias(spectrum *[GRANULE_SIZE]float64, g *granuleInfo) {
+	subbands := SUBBANDS
+	if g.short() {
+		if !g.mixed {
+			return
+		}
+		subbands = 2
+	}
+	for sb := 1; sb < subbands; sb++ {
+		for i := 0; i < 8; i++ {
+			lower, upper := spectrum[sb*SUBBAND_SIZE-1-i], spectrum[sb*SUBBAND_SIZE+i]
+			spectrum[sb*SUBBAND_SIZE-1-i] = lower*antialiasCs[i] - upper*antialiasCa[i]
+			spectrum[sb*SUBBAND_SIZE+i] = upper*antialiasCs[i] + lower*antialiasCa[i]
+		}
+	}
+}
+
+// imdct
+
+var imdctLong, imdctShort = func() ([36][18]float64, [12][6]float64) {
+	var long [36][18]float64
+	var short [12][6]float64
+	for i := range long {
+		for k := range long[i] {
+			long[i][k] = math.Cos(math.Pi / 72 * float64((2*i+1+18)*(2*k+1)))
+		}
+	}
+	for i := range short {
+		for k := range short[i] {
+			short[i][k] = math.Cos(math.Pi / 24 * float64((2*i+1+6)*(2*k+1)))
+		}
+	}
+	return long, short
+}()
+
+// windows by block type
+var imdctWindows = func() [4][36]float64 {
+	var windows [4][36]float64
+	for i := 0; i < 36; i++ {
+		windows[0][i] = math.Sin(math.Pi / 36 * (float64(i) + 0.5))
+	}
+	for i := 0; i < 18; i++ {
+		windows[1][i] = windows[0][i]
+		windows[3][i+18] = windows[0][i+18]
+	}
+	for i := 0; i < 6; i++ {
+		windows[1][i+18] = 1
+		windows[1][i+24] = math.Sin(math.Pi / 12 * (float64(i+6) + 0.5))
+		windows[3][i+6] = math.Sin(math.Pi / 12 * (float64(i) + 0.5))
+		windows[3][i+12] = 1
+	}
+	for i := 0; i < 12; i++ {
+		windows[2][i] = math.Sin(math.Pi / 12 * (float64(i) + 0.5))
+	}
+	return windows
+}()
+
+// hybrid transforms the spectrum of a channel to subband samples by time.
+func (d *Decoder) hybrid(spectrum *[GRANULE_SIZE]float64, g *granuleInfo, ch int) *[SUBBAND_SIZE][SUBBANDS]float64 {
+	var samples [SUBBAND_SIZE][SUBBANDS]float64
+	for sb := 0; sb < SUBBANDS; sb++ {
+		in := spectrum[sb*SUBBAND_SIZE : (sb+1)*SUBBAND_SIZE]
+		blockType := 0
+		if g.windowSwitching && !(g.mixed && sb < 2) {
+			blockType = g.blockType
+		}
+
+		var raw [36]float64
+		if blockType == 2 {
+			for w := 0; w < 3; w++ {
+				for i := 0; i < 12; i++ {
+					sum := 0.0
+					for k := 0; k < 6; k++ {
+						sum += in[k*3+w] * imdctShort[i][k]
+					}
+					raw[6+6*w+i] += sum * imdctWindows[2][i]
+				}
+			}
+		} else {
+			for i := 0; i < 36; i++ {
+				sum := 0.0
+				for k := 0; k < 18; k++ {
+					sum += in[k] * imdctLong[i][k]
+				}
+				raw[i] = sum * imdctWindows[blockType][i]
+			}
+		}
+
+		overlap := &d.overlap[ch][sb]
+		for i := 0; i < SUBBAND_SIZE; i++ {
+			sample := raw[i] + overlap[i]
+			overlap[i] = raw[i+SUBBAND_SIZE]
+			// frequency inversion
+			if sb%2 == 1 && i%2 == 1 {
+				sample = -sample
+			}
+			samples[i][sb] = sample
+		}
+	}
+	return &samples
+}
+
+// polyphase synthesis
+
+var synthWindow = func() [512]float64 {
+	var window [512]float64
+	for i, value := range synthWindowHalf {
+		window[i] = float64(value) / 65536
+		if i > 0 && i < 256 {
+			if i%64 == 0 {
+				window[512-i] = window[i]
+			} else {
+				window[512-i] = -window[i]
+			}
+		}
+	}
+	return window
+}()
+
+var synthMatrix = func() [64][32]float64 {
+	var matrix [64][32]float64
+	for i := range matrix {
+		for k := range matrix[i] {
+			matrix[i][k] = math.Cos(float64((16+i)*(2*k+1)) * math.Pi / 64)
+		}
+	}
+	return matrix
+}()
+
+type synthesis struct {
+	v      [1024]float64
+	offset int
+}
+
+// run writes 32 pcm samples for each time of samples to out.
+func (s *synthesis) run(samples *[SUBBAND_SIZE][SUBBANDS]float64, out []float32) {
+	for t := 0; t < SUBBAND_SIZE; t++ {
+		s.offset = (s.offset - 64) & 1023
+		for i := 0; i < 64; i++ {
+			sum := 0.0
+			for k := 0; k < SUBBANDS; k++ {
+				sum += synthMatrix[i][k] * samples[t][k]
+			}
+			s.v[s.offset+i] = sum
+		}
+		for j := 0; j < SUBBANDS; j++ {
+			sum := 0.0
+			for i := 0; i < 8; i++ {
+				sum += s.v[(s.offset+128*i+j)&1023] * synthWindow[64*i+j]
+				sum += s.v[(s.offset+128*i+96+j)&1023] * synthWindow[64*i+32+j]
+			}
+			out[t*SUBBANDS+j] = float32(max(-1, min(1, sum)))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/mp3"
+)
+
+const RECONNECT_DELAY time.Duration = 2 * time.Second
+
+type FrameHandler interface {
+	// Frame is called for every mpeg audio frame with its receive time.
+	Frame(frame []byte, header mp3.Header, received time.Time)
+	// Reset is called when the stream was interrupted.
+	Reset()
+}
+
+// Receive reads the stream from url and passes every frame to handler. The
+// stream fails if no frame arrives within timeout. status is optional.
+func Receive(url string, timeout time.Duration, reconnect bool, handler FrameHandler, status *Status) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:           (&net.Dialer{Timeout: timeout}).DialContext,
+			ResponseHeaderTimeout: timeout,
+		},
+	}
+
+	for {
+		err := receive(client, url, timeout, handler, status)
+		status.Interrupted(err)
+		if !reconnect {
+			return err
+		}
+		log.Err(err, "stream interrupted, reconnect in", RECONNECT_DELAY, url)
+		handler.Reset()
+		time.Sleep(RECONNECT_DELAY)
+	}
+}
+
+func receive(client *http.Client, url string, timeout time.Duration, handler FrameHandler, status *Status) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New("status code " + strconv.Itoa(resp.StatusCode))
+	}
+	log.Info("Receive stream", url)
+
+	// cancel the request if the stream stalls
+	watchdog := time.AfterFunc(timeout, cancel)
+	defer watchdog.Stop()
+
+	reader := mp3.NewFrameReader(resp.Body)
+	for {
+		frame, header, err := reader.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return errors.New("no data within " + timeout.String())
+			}
+			return err
+		}
+		watchdog.Reset(timeout)
+		received := time.Now()
+		status.Received(received)
+		handler.Frame(frame, header, received)
+	}
+}
@@ -0,0 +1,47 @@
+package receiver
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type validator struct {
+	err error
+}
+
+func (v *validator) Validate(data []byte, failEarly bool) error {
+	return v.err
+}
+
+func TestValidatorStatus(t *testing.T) {
+	status := NewStatus(50*time.Millisecond, nil)
+	failing := &validator{}
+	v := NewValidator(failing, status)
+	if check := status.Check(); check.Ready {
+		t.Error("ready without data")
+	}
+
+	v.Validate([]byte{0}, false)
+	if check := status.Check(); !check.Ready {
+		t.Errorf("not ready: %s", check.Detail)
+	}
+
+	// a failing validator flips readiness
+	failing.err = errors.New("unexpected bitrate")
+	v.Validate([]byte{0}, false)
+	if check := status.Check(); check.Ready {
+		t.Error("ready while validation fails")
+	}
+	failing.err = nil
+	v.Validate([]byte{0}, false)
+	if check := status.Check(); !check.Ready {
+		t.Errorf("not ready after recovery: %s", check.Detail)
+	}
+
+	// no data within timeout
+	time.Sleep(60 * time.Millisecond)
+	if check := status.Check(); check.Ready {
+		t.Error("ready without data within timeout")
+	}
+}
@@ -0,0 +1,81 @@
+package receiver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+)
+
+// Checker is implemented by frame handlers which can fail, e.g. validators.
+type Checker interface {
+	Check() error
+}
+
+// Status tracks if a stream is received. It is safe for concurrent use.
+type Status struct {
+	timeout time.Duration
+	checker Checker
+
+	mu        sync.Mutex
+	receiving bool
+	lastData  time.Time
+	err       error
+}
+
+func NewStatus(timeout time.Duration, checker Checker) *Status {
+	return &Status{timeout: timeout, checker: checker}
+}
+
+func (s *Status) SetChecker(checker Checker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checker = checker
+}
+
+// Received marks data as received at t.
+func (s *Status) Received(t time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.receiving = true
+	s.lastData = t
+	s.err = nil
+}
+
+func (s *Status) Interrupted(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.receiving = false
+	s.err = err
+}
+
+// Check is ready, if data arrived within timeout and the checker is not
+// failing.
+func (s *Status) Check() metricmanager.Check {
+	s.mu.Lock()
+	receiving, lastData, err, checker := s.receiving, s.lastData, s.err, s.checker
+	s.mu.Unlock()
+
+	if !receiving {
+		detail := "not receiving"
+		if err != nil {
+			detail += ": " + err.Error()
+		}
+		return metricmanager.Check{Ready: false, Detail: detail}
+	}
+	if !lastData.IsZero() && time.Since(lastData) > s.timeout {
+		return metricmanager.Check{Ready: false, Detail: "no data since " + lastData.UTC().Format(time.RFC3339)}
+	}
+	if checker != nil {
+		if err := checker.Check(); err != nil {
+			return metricmanager.Check{Ready: false, Detail: "validation failing: " + err.Error()}
+		}
+	}
+	return metricmanager.Check{Ready: true, Detail: "receiving"}
+}
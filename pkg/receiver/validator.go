@@ -0,0 +1,40 @@
+package receiver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/network"
+)
+
+// Validator passes the data of a stream to a data validator and reports data
+// and validation results to status. Readiness fails while the last validation
+// failed.
+type Validator struct {
+	validator network.DataValidator
+	status    *Status
+
+	mu  sync.Mutex
+	err error
+}
+
+func NewValidator(validator network.DataValidator, status *Status) *Validator {
+	v := &Validator{validator: validator, status: status}
+	status.SetChecker(v)
+	return v
+}
+
+func (v *Validator) Validate(data []byte, failEarly bool) error {
+	v.status.Received(time.Now())
+	err := v.validator.Validate(data, failEarly)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.err = err
+	return err
+}
+
+func (v *Validator) Check() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.err
+}
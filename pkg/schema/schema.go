@@ -0,0 +1,219 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Schema is a subset of JSON Schema: type, enum, const, required,
+// properties, additionalProperties (bool), items, minItems, maxItems,
+// minLength, maxLength, pattern, minimum and maximum. The annotations $schema,
+// $id, $comment, title, description, default and examples are ignored, other
+// keywords are rejected by Read.
+type Schema struct {
+	Type                 any                `json:"type"`
+	Enum                 []any              `json:"enum"`
+	Const                any                `json:"const"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+
+	// annotations
+	Dialect     string `json:"$schema"`
+	Id          string `json:"$id"`
+	Comment     string `json:"$comment"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Default     any    `json:"default"`
+	Examples    []any  `json:"examples"`
+
+	pattern *regexp.Regexp
+}
+
+// Read reads file, rejects unsupported keywords and compiles its patterns.
+func Read(file string) (*Schema, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var schema Schema
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&schema); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return nil, fmt.Errorf("schema %s: unsupported keyword %s", file, field)
+		}
+		return nil, fmt.Errorf("schema %s: %w", file, err)
+	}
+	if err := schema.compile("$"); err != nil {
+		return nil, fmt.Errorf("schema %s: %w", file, err)
+	}
+	return &schema, nil
+}
+
+// Validate returns the first violation of value, decoded by encoding/json.
+func (s *Schema) Validate(value any) error {
+	return s.validate("$", value)
+}
+
+func (s *Schema) validate(path string, value any) error {
+	if s == nil {
+		return nil
+	}
+	if !s.matchesType(value) {
+		return fmt.Errorf("%s: want type %v, got %s", path, s.Type, typeName(value))
+	}
+	if len(s.Enum) > 0 && !contains(s.Enum, value) {
+		return fmt.Errorf("%s: %v not in enum", path, value)
+	}
+	if s.Const != nil && !equal(s.Const, value) {
+		return fmt.Errorf("%s: want %v, got %v", path, s.Const, value)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: required property %s missing", path, name)
+			}
+		}
+		for name, property := range v {
+			schema, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: additional property %s", path, name)
+				}
+				continue
+			}
+			if err := schema.validate(path+"."+name, property); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%s: less than %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fmt.Errorf("%s: more than %d items", path, *s.MaxItems)
+		}
+		for i, item := range v {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: shorter than %d", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: longer than %d", path, *s.MaxLength)
+		}
+		if s.pattern != nil {
+			if !s.pattern.MatchString(v) {
+				return fmt.Errorf("%s: %q does not match %s", path, v, s.Pattern)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s: %v < minimum %v", path, v, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s: %v > maximum %v", path, v, *s.Maximum)
+		}
+	}
+	return nil
+}
+
+// compile compiles the patterns of s and its sub schemas.
+func (s *Schema) compile(path string) error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", path, err)
+		}
+		s.pattern = pattern
+	}
+	for name, property := range s.Properties {
+		if err := property.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	return s.Items.compile(path + "[]")
+}
+
+// matchesType is true, if value has one of the types of the schema.
+func (s *Schema) matchesType(value any) bool {
+	types := []string{}
+	switch t := s.Type.(type) {
+	case nil:
+		return true
+	case string:
+		types = append(types, t)
+	case []any:
+		for _, name := range t {
+			types = append(types, fmt.Sprint(name))
+		}
+	}
+	actual := typeName(value)
+	for _, name := range types {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// helper
+
+func typeName(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return strings.ToLower(fmt.Sprintf("%T", v))
+	}
+}
+
+func contains(values []any, value any) bool {
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a any, b any) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
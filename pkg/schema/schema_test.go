@@ -0,0 +1,33 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadKeywords(t *testing.T) {
+	tests := map[string]string{
+		`{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "event", "type": "object"}`: "",
+		`{"oneOf": [{"type": "string"}, {"type": "number"}]}`:                                             "oneOf",
+		`{"properties": {"isrc": {"type": "string", "format": "isrc"}}}`:                                  "format",
+		`{"items": {"$ref": "#/definitions/item"}}`:                                                       "$ref",
+		`{"properties": {"isrc": {"pattern": "("}}}`:                                                      "$.isrc",
+	}
+	folder := t.TempDir()
+	for data, want := range tests {
+		file := filepath.Join(folder, "schema.json")
+		os.WriteFile(file, []byte(data), 0644)
+		_, err := Read(file)
+		if want == "" {
+			if err != nil {
+				t.Errorf("%s: got %v", data, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want error on %s", data, err, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package streamer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/asrun"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/metadata"
+	"github.com/nice-pink/streamey/pkg/mp3"
+)
+
+// asRunRecorder writes start and end of every played item to the as-run log.
+// The planned schedule continues from the previous planned stop, so delays
+// and skips show up as difference between planned and actual times.
+type asRunRecorder struct {
+	channelName string
+	config      configmanager.AsRunConfig
+	logger      *asrun.Logger
+	planned     time.Time
+}
+
+func newAsRunRecorder(config configmanager.StreamConfig) *asRunRecorder {
+	r := &asRunRecorder{channelName: config.ChannelName}
+	r.configure(config)
+	return r
+}
+
+// configure reopens the log, if the as-run config changed.
+func (r *asRunRecorder) configure(config configmanager.StreamConfig) {
+	if r.logger != nil && r.config == config.AsRun {
+		return
+	}
+	r.close()
+	r.config = config.AsRun
+	if !config.AsRun.Enabled {
+		return
+	}
+	logger, err := asrun.NewLogger(r.channelName, config.AsRun)
+	if err != nil {
+		log.Err(err, r.channelName, "cannot create as-run log")
+		return
+	}
+	r.logger = logger
+}
+
+// replan starts a new schedule with the next item, e.g. after a jump.
+func (r *asRunRecorder) replan() {
+	r.planned = time.Time{}
+}
+
+func (r *asRunRecorder) start(index int, item configmanager.PlaylistItem, duration time.Duration, fallback bool, metaResult <-chan error) asrun.Entry {
+	now := time.Now().UTC()
+	if r.planned.IsZero() {
+		r.planned = now
+	}
+	entry := asrun.Entry{
+		Channel:      r.channelName,
+		Event:        asrun.EventStart,
+		Index:        index,
+		Type:         item.Type,
+		Artist:       item.Artist,
+		Title:        item.Title,
+		Album:        item.Album,
+		Filepath:     item.Filepath,
+		Duration:     duration.Seconds(),
+		Fallback:     fallback,
+		PlannedStart: r.planned,
+		PlannedStop:  r.planned.Add(duration),
+		ActualStart:  now,
+		Metadata:     asrun.MetadataNone,
+	}
+	if metaResult != nil {
+		entry.Metadata = asrun.MetadataPending
+	}
+	r.planned = entry.PlannedStop
+	r.write(entry)
+	return entry
+}
+
+// end records the end of entry. Metadata is delivered meanwhile in most cases.
+func (r *asRunRecorder) end(entry asrun.Entry, bytes int, metaResult <-chan error) {
+	stop := time.Now().UTC()
+	entry.Event = asrun.EventEnd
+	if metaResult != nil {
+		select {
+		case err := <-metaResult:
+			entry.Metadata = metadataResult(err)
+		default:
+		}
+	}
+	entry.ActualStop = &stop
+	entry.Bytes = bytes
+	r.write(entry)
+}
+
+func (r *asRunRecorder) write(entry asrun.Entry) {
+	if r.logger == nil {
+		return
+	}
+	if err := r.logger.Write(entry); err != nil {
+		log.Err(err, r.channelName, "as-run log write failed")
+	}
+}
+
+func (r *asRunRecorder) close() {
+	if r.logger != nil {
+		r.logger.Close()
+		r.logger = nil
+	}
+}
+
+// helper
+
+func metadataResult(err error) string {
+	switch {
+	case err == nil:
+		return asrun.MetadataOk
+	case errors.Is(err, metadata.ErrSpooled):
+		return asrun.MetadataSpooled
+	default:
+		return asrun.MetadataFailed
+	}
+}
+
+// itemDuration returns the duration of the frames of data, it is what is
+// sent. The configured duration is used for data without frames, like items
+// not loaded yet.
+func itemDuration(item configmanager.PlaylistItem, data []byte) time.Duration {
+	var duration time.Duration
+	for _, frame := range mp3.Frames(data) {
+		duration += frame.Header.Duration()
+	}
+	if duration > 0 {
+		return duration
+	}
+	return time.Duration(item.Duration * float64(time.Second))
+}
@@ -0,0 +1,29 @@
+package streamer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/mp3"
+)
+
+func TestItemDuration(t *testing.T) {
+	item := configmanager.PlaylistItem{Duration: 254.29}
+	data, err := mp3.SilentFrames(128000, 44100, false, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames time.Duration
+	for _, frame := range mp3.Frames(data) {
+		frames += frame.Header.Duration()
+	}
+
+	// loaded data is sent, its frames define the duration
+	if duration := itemDuration(item, data); duration != frames {
+		t.Errorf("loaded: got %v, want %v", duration, frames)
+	}
+	if duration := itemDuration(item, nil); duration != 254290*time.Millisecond {
+		t.Errorf("not loaded: got %v, want configured 254.29s", duration)
+	}
+}
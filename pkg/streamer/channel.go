@@ -0,0 +1,412 @@
+package streamer
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nice-pink/audio-tool/pkg/network"
+	"github.com/nice-pink/audio-tool/pkg/stream"
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/metadata"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+	"github.com/nice-pink/streamey/pkg/template"
+)
+
+const (
+	StateStopped    string = "stopped"
+	StateConnecting string = "connecting"
+	StateStreaming  string = "streaming"
+	StateFallback   string = "fallback"
+)
+
+var (
+	ErrNoMetadata = errors.New("no metadata sink")
+	ErrNotPlaying = errors.New("no item started yet")
+)
+
+type ChannelStatus struct {
+	Name        string
+	State       string
+	Index       int
+	Item        configmanager.PlaylistItem
+	ItemStarted time.Time
+	Started     time.Time
+	Uptime      time.Duration
+	Loops       int
+}
+
+type Channel struct {
+	Name    string
+	metrics util.MetricsControl
+	verbose bool
+
+	mu          sync.Mutex
+	config      configmanager.StreamConfig
+	pending     *configmanager.StreamConfig
+	running     bool
+	started     time.Time
+	index       int
+	item        configmanager.PlaylistItem
+	itemStarted time.Time
+	fallback    bool
+	loops       int
+	sender      *sender
+	metaSendFn  func(info template.TrackInfo, at time.Time) (<-chan error, func() bool)
+	playing     *nowPlaying
+
+	skip     atomic.Bool
+	jump     atomic.Int64
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func NewChannel(config configmanager.StreamConfig, metrics util.MetricsControl, verbose bool) *Channel {
+	c := &Channel{
+		Name:    config.ChannelName,
+		metrics: metrics,
+		verbose: verbose,
+		config:  config,
+		playing: newNowPlaying(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	c.jump.Store(-1)
+	return c
+}
+
+// Config returns the config of the channel including pending updates.
+func (c *Channel) Config() configmanager.StreamConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != nil {
+		return *c.pending
+	}
+	return c.config
+}
+
+// Update applies config at the next item boundary without reconnecting.
+func (c *Channel) Update(config configmanager.StreamConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = &config
+}
+
+// Stop stops streaming and waits until the connection is closed.
+func (c *Channel) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	if c.Running() {
+		<-c.done
+	}
+}
+
+func (c *Channel) Running() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running
+}
+
+// Skip stops the current item and continues with the next one.
+func (c *Channel) Skip() {
+	c.skip.Store(true)
+}
+
+// Jump continues with the item at index of the playlist.
+func (c *Channel) Jump(index int) {
+	c.jump.Store(int64(index))
+	c.skip.Store(true)
+}
+
+// PushMetadata sends the metadata of the current item now.
+func (c *Channel) PushMetadata() error {
+	c.mu.Lock()
+	metaSendFn := c.metaSendFn
+	c.mu.Unlock()
+
+	if metaSendFn == nil {
+		return ErrNoMetadata
+	}
+	// new event of the current item
+	playing, err := c.playing.get(c.Name)
+	if err != nil {
+		return err
+	}
+	info := playing.Current
+	info.Uuid = uuid.NewString()
+	metaResult, _ := metaSendFn(info, time.Now())
+	if metaResult == nil {
+		return nil
+	}
+	return <-metaResult
+}
+
+// NowPlaying returns the current and next item, ErrNotPlaying before the
+// first item started.
+func (c *Channel) NowPlaying() (NowPlaying, error) {
+	return c.playing.get(c.Name)
+}
+
+// SubscribeNowPlaying returns the now playing state on every item change
+// until unsubscribe is called or the channel stops.
+func (c *Channel) SubscribeNowPlaying() (<-chan NowPlaying, func()) {
+	return c.playing.subscribe()
+}
+
+func (c *Channel) Status() ChannelStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := ChannelStatus{
+		Name:        c.Name,
+		State:       StateStopped,
+		Index:       c.index,
+		Item:        c.item,
+		ItemStarted: c.itemStarted,
+		Started:     c.started,
+		Loops:       c.loops,
+	}
+	if !c.running {
+		return status
+	}
+	status.Uptime = time.Since(c.started)
+	switch {
+	case c.sender == nil || !c.sender.connected.Load():
+		status.State = StateConnecting
+	case c.fallback:
+		status.State = StateFallback
+	default:
+		status.State = StateStreaming
+	}
+	return status
+}
+
+func (c *Channel) stopped() bool {
+	return closed(c.stop)
+}
+
+// current returns the config to use for the next item.
+func (c *Channel) current() (configmanager.StreamConfig, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		return c.config, false
+	}
+	c.config = *c.pending
+	c.pending = nil
+	return c.config, true
+}
+
+func (c *Channel) setRunning(running bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = running
+	if running {
+		c.started = time.Now()
+	}
+}
+
+func (c *Channel) setItem(index int, item configmanager.PlaylistItem, fallback bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.index = index
+	c.item = item
+	c.itemStarted = time.Now()
+	c.fallback = fallback
+}
+
+// Run streams the playlist until the channel is stopped.
+func (c *Channel) Run() {
+	c.setRunning(true)
+	c.run()
+}
+
+// Start runs the channel in the background.
+func (c *Channel) Start() {
+	c.setRunning(true)
+	go c.run()
+}
+
+func (c *Channel) run() {
+	defer close(c.done)
+	defer c.setRunning(false)
+	defer c.playing.close()
+
+	config, _ := c.current()
+	if len(config.Playlist.Items) == 0 {
+		log.Error("no playlist items", c.Name)
+		return
+	}
+
+	// get url
+	streamFormat := configmanager.GetStreamFormat(config.Audio.Format)
+	url, connTarget, err := getUrlAndTarget(config.Audio.TargetUrl, streamFormat)
+	if err != nil {
+		log.Err(err, "Icy address", c.Name)
+		return
+	}
+	log.Info("Stream data with bitrate", config.Audio.Bitrate, "to", url)
+
+	// stream
+	log.Info("Conn to url", url)
+	port := 80
+	if strings.HasPrefix(url, "https://") {
+		port = 443
+	}
+	metricsControl := metricmanager.WithLabel(c.metrics, "channel", c.Name)
+	connection := network.NewConnection(url, "", port, 0, time.Duration(CONNECT_TIMEOUT_SEC), network.HttpConnection, metricsControl)
+	connection.VerboseLogs = c.verbose
+	defer connection.Close()
+
+	metrics := newChannelMetrics(c.metrics, c.Name)
+	defer metrics.setConnected(false)
+
+	// send metadata to all sinks
+	sequenceFile := config.Metadata.GetSequenceFile(c.Name)
+	sequence, err := metadata.NewSequence(sequenceFile)
+	if err != nil {
+		log.Err(err, c.Name, "cannot read sequence file, sequence starts at 1", sequenceFile)
+		sequence, _ = metadata.NewSequence("")
+	}
+	sinks := newMetaSinks(config, metricsControl)
+	defer sinks.close()
+	metaSendFn := sinks.send
+
+	// init function
+	var initFn func() error
+	if streamFormat == configmanager.StreamFormatIcecast || streamFormat == configmanager.StreamFormatShoutcast {
+		log.Info("Establish icecast connection.")
+		initFn = func() error {
+			// header
+			var header []byte
+			var err error
+			switch streamFormat {
+			case configmanager.StreamFormatIcecast:
+				meta := stream.IcyMeta{Bitrate: int(config.Audio.Bitrate), Channels: 2, SampleRate: config.Audio.SampleRate, Url: config.Audio.TargetUrl}
+				header, err = stream.GetIcecastPutHeader(connTarget, meta, HTTP_VERSION, false)
+			case configmanager.StreamFormatShoutcast:
+				header, err = stream.GetShoutcastSourceHeader(connTarget, HTTP_VERSION, false)
+			}
+			if err != nil {
+				return err
+			}
+
+			// log get socket conn
+			conn, err := connection.GetSocketConn()
+			if err != nil {
+				log.Err(err, "no socket connection in initFn")
+				return err
+			}
+			if !network.WriteHeader(conn, header, 3, HTTP_VERSION, true, false) {
+				return errors.New("could not send header")
+			}
+			return nil
+		}
+	} else {
+		log.Info("Establish connection.")
+		metaSendFn = nil
+	}
+
+	// send playlist
+	s := newSender(config, connection, initFn, c.stop, &c.skip, metrics, c.verbose)
+	f := newFallback(config, metrics)
+	r := newAsRunRecorder(config)
+	defer r.close()
+	c.mu.Lock()
+	c.sender = s
+	c.metaSendFn = metaSendFn
+	c.mu.Unlock()
+
+	s.open(float64(config.Audio.Bitrate))
+	index := 0
+	var ahead *scheduledMeta
+	for !c.stopped() {
+		config, updated := c.current()
+		if updated {
+			log.Info(c.Name, "apply updated config")
+			s.configure(config)
+			f.configure(config)
+			r.configure(config)
+			sinks.configure(config)
+		}
+
+		items := config.Playlist.Items
+		if jump := c.jump.Swap(-1); jump >= 0 {
+			index = int(jump)
+			r.replan()
+		}
+		if index >= len(items) {
+			index = 0
+			c.mu.Lock()
+			c.loops++
+			c.mu.Unlock()
+			metrics.loops.Inc()
+		}
+		metrics.itemIndex.Set(float64(index))
+
+		item := items[index]
+		c.setItem(index, item, false)
+		data := getData(item.Filepath)
+		duration := itemDuration(item, data)
+		played := item
+		isFallback := len(data) == 0
+		if isFallback {
+			log.Error("no data in file", item.Filepath)
+			data, played, duration = f.silence(item)
+			c.setItem(index, played, true)
+		} else {
+			f.reference(data)
+		}
+
+		now := time.Now()
+		seq, err := sequence.Next()
+		if err != nil {
+			log.Err(err, c.Name, "cannot write sequence file")
+		}
+		loops := c.Status().Loops
+		info := channelTrackInfo(config, played, index, loops, seq, now, duration)
+		next := (index + 1) % len(items)
+		nextLoops := loops
+		if next == 0 {
+			nextLoops++
+		}
+		nextInfo := channelTrackInfo(config, items[next], next, nextLoops, sequence.Peek(), info.Stop, itemDuration(items[next], nil))
+		c.playing.set(c.Name, info, nextInfo)
+
+		// metadata is sent at audio start plus offset, items are announced
+		// ahead with a negative offset
+		var metaResult <-chan error
+		if metaSendFn != nil {
+			offset := time.Duration(config.Metadata.OffsetSec * float64(time.Second))
+			if ahead != nil && ahead.index == index && !isFallback && !now.Before(ahead.at) {
+				metaResult = ahead.result
+			} else {
+				if ahead != nil {
+					ahead.cancel()
+				}
+				metaResult, _ = metaSendFn(shift(info, offset), now.Add(offset))
+			}
+			ahead = nil
+			if offset < 0 {
+				at := now.Add(duration + offset)
+				result, cancel := metaSendFn(shift(nextInfo, offset), at)
+				ahead = &scheduledMeta{index: next, at: at, result: result, cancel: cancel}
+			}
+		}
+		entry := r.start(index, item, duration, isFallback, metaResult)
+		var sent int
+		if isFallback {
+			sent = f.send(s, data, duration)
+		} else {
+			sent = s.send(data)
+		}
+		r.end(entry, sent, metaResult)
+		index++
+	}
+	log.Info(c.Name, "stopped")
+}
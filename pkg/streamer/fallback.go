@@ -0,0 +1,112 @@
+package streamer
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/mp3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	FALLBACK_DURATION_SEC float64 = 10
+	FALLBACK_TITLE        string  = "Silence"
+)
+
+// fallback keeps the mount alive with silence, if a playlist item can't be
+// loaded. Silence matches the last working item or the audio config. Only mp3
+// silence is generated, channels of other codecs just wait.
+type fallback struct {
+	channelName string
+	audio       configmanager.AudioConfig
+	item        configmanager.PlaylistItem
+	header      *mp3.Header
+	// last working item is no mp3
+	otherCodec bool
+	seconds    prometheus.Counter
+	skipped    prometheus.Counter
+}
+
+func newFallback(config configmanager.StreamConfig, metrics *channelMetrics) *fallback {
+	f := &fallback{channelName: config.ChannelName, seconds: metrics.fallbackSeconds, skipped: metrics.fallbackSkipped}
+	f.configure(config)
+	return f
+}
+
+func (f *fallback) configure(config configmanager.StreamConfig) {
+	f.audio = config.Audio
+	f.item = config.Playlist.Fallback
+	if f.item.Title == "" {
+		f.item.Title = FALLBACK_TITLE
+	}
+}
+
+// reference remembers the format of a working item. Data counts as mp3, if
+// layer 3 frames make up most of it.
+func (f *fallback) reference(data []byte) {
+	frames := mp3.Frames(data)
+	size := 0
+	for _, frame := range frames {
+		if frame.Header.Layer == 3 {
+			size += frame.Header.FrameSize
+		}
+	}
+	if size < len(data)/2 {
+		f.header, f.otherCodec = nil, true
+		return
+	}
+	f.header, f.otherCodec = &frames[0].Header, false
+}
+
+// isMp3 returns true if the channel streams mp3, as far as known.
+func (f *fallback) isMp3(failed configmanager.PlaylistItem) bool {
+	if f.header != nil || f.otherCodec {
+		return !f.otherCodec
+	}
+	ext := strings.ToLower(path.Ext(failed.Filepath))
+	return ext == "" || ext == ".mp3"
+}
+
+// silence returns silence for the duration of the failed item and the item to
+// announce instead. data is nil, if no silence can be created.
+func (f *fallback) silence(failed configmanager.PlaylistItem) ([]byte, configmanager.PlaylistItem, time.Duration) {
+	durationSec := failed.Duration
+	if durationSec <= 0 {
+		durationSec = FALLBACK_DURATION_SEC
+	}
+	duration := time.Duration(durationSec * float64(time.Second))
+	item := f.item
+	item.Duration = durationSec
+
+	if !f.isMp3(failed) {
+		log.Warn(f.channelName, "no mp3 stream, skip silence and wait", duration)
+		f.skipped.Inc()
+		return nil, item, duration
+	}
+	bitrate, sampleRate, mono := f.audio.Bitrate, f.audio.SampleRate, false
+	if f.header != nil {
+		bitrate, sampleRate, mono = f.header.Bitrate, f.header.SampleRate, f.header.ChannelMode == mp3.ChannelModeMono
+	}
+	data, err := mp3.SilentFrames(bitrate, sampleRate, mono, duration)
+	if err != nil {
+		log.Err(err, f.channelName, "cannot create silence with bitrate", bitrate, "and sample rate", sampleRate)
+		return nil, item, duration
+	}
+	log.Warn(f.channelName, "stream silence for", duration)
+	return data, item, duration
+}
+
+// send streams silence and returns the bytes sent. Without silence it just
+// waits for duration.
+func (f *fallback) send(s *sender, data []byte, duration time.Duration) int {
+	start := time.Now()
+	defer func() { f.seconds.Add(time.Since(start).Seconds()) }()
+	if data == nil {
+		sleep(duration, s.stop)
+		return 0
+	}
+	return s.send(data)
+}
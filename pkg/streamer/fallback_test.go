@@ -0,0 +1,49 @@
+package streamer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/mp3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFallbackCodec(t *testing.T) {
+	config := configmanager.StreamConfig{ChannelName: "test", Audio: configmanager.AudioConfig{Bitrate: 128000, SampleRate: 44100}}
+	metrics := newChannelMetrics(util.MetricsControl{}, "test")
+	f := newFallback(config, metrics)
+	failed := configmanager.PlaylistItem{Filepath: "missing.mp3", Duration: 1}
+
+	// mp3 reference
+	reference, err := mp3.SilentFrames(64000, 22050, true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.reference(reference)
+	data, _, _ := f.silence(failed)
+	frames := mp3.Frames(data)
+	if len(frames) == 0 || frames[0].Header.Bitrate != 64000 || frames[0].Header.SampleRate != 22050 {
+		t.Fatalf("silence: got %d frames", len(frames))
+	}
+
+	// adts aac reference
+	f.reference(bytes.Repeat([]byte{0xFF, 0xF1, 0x50, 0x80, 0x02, 0x1F, 0xFC, 0x21}, 512))
+	if data, _, duration := f.silence(failed); data != nil || duration != time.Second {
+		t.Errorf("aac silence: got %d bytes for %v", len(data), duration)
+	}
+	if skipped := testutil.ToFloat64(metrics.fallbackSkipped); skipped != 1 {
+		t.Errorf("skipped: got %f", skipped)
+	}
+
+	// without reference by file extension
+	f = newFallback(config, metrics)
+	if data, _, _ := f.silence(configmanager.PlaylistItem{Filepath: "missing.aac"}); data != nil {
+		t.Error("silence for aac item")
+	}
+	if data, _, _ := f.silence(failed); data == nil {
+		t.Error("no silence for mp3 item")
+	}
+}
@@ -0,0 +1,118 @@
+package streamer
+
+import (
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/mp3"
+)
+
+const (
+	FAULT_INTERVAL_SEC float64 = 60
+	FAULT_DURATION_SEC float64 = 5
+	FAULT_FRAMES       int     = 10
+)
+
+// faultInjector misbehaves on purpose. Faults start at random with an average
+// distance of the configured interval. Every fault is logged with timestamp.
+type faultInjector struct {
+	channelName string
+	interval    time.Duration
+	faults      []configmanager.Fault
+	next        time.Time
+	rateUntil   time.Time
+	truncate    int
+	corrupt     int
+}
+
+func newFaultInjector(channelName string, config configmanager.FaultConfig) *faultInjector {
+	if !config.Enabled || len(config.Faults) == 0 {
+		return nil
+	}
+	intervalSec := config.IntervalSec
+	if intervalSec <= 0 {
+		intervalSec = FAULT_INTERVAL_SEC
+	}
+	f := &faultInjector{channelName: channelName, interval: time.Duration(intervalSec * float64(time.Second)), faults: config.Faults}
+	f.schedule(time.Now())
+	return f
+}
+
+func (f *faultInjector) schedule(now time.Time) {
+	wait := time.Duration(rand.ExpFloat64() * float64(f.interval))
+	f.next = now.Add(wait)
+}
+
+// before is called before a unit is sent. It starts the next fault if it is due
+// and returns true if the connection should be dropped.
+func (f *faultInjector) before(p *pacer) bool {
+	now := time.Now()
+	if !f.rateUntil.IsZero() && !now.Before(f.rateUntil) {
+		f.rateUntil = time.Time{}
+		p.setFactor(1)
+		f.log(now, "rate restored")
+	}
+	if now.Before(f.next) {
+		return false
+	}
+	f.schedule(now)
+
+	fault := f.faults[rand.IntN(len(f.faults))]
+	durationSec := fault.DurationSec
+	if durationSec <= 0 {
+		durationSec = FAULT_DURATION_SEC
+	}
+	duration := time.Duration(durationSec * float64(time.Second))
+	frames := fault.Frames
+	if frames <= 0 {
+		frames = FAULT_FRAMES
+	}
+
+	switch strings.ToLower(fault.Type) {
+	case configmanager.FaultStall:
+		f.log(now, configmanager.FaultStall, duration)
+		p.pause(duration)
+	case configmanager.FaultBurst, configmanager.FaultThrottle:
+		f.log(now, fault.Type, "rate factor", fault.Factor, "for", duration)
+		p.setFactor(fault.Factor)
+		f.rateUntil = now.Add(duration)
+	case configmanager.FaultDrop:
+		f.log(now, configmanager.FaultDrop)
+		return true
+	case configmanager.FaultTruncate:
+		f.log(now, configmanager.FaultTruncate, frames, "frames")
+		f.truncate = frames
+	case configmanager.FaultCorrupt:
+		f.log(now, configmanager.FaultCorrupt, frames, "frames")
+		f.corrupt = frames
+	}
+	return false
+}
+
+// modify returns the unit to send. Truncated or corrupted units are copies, so
+// the source buffer stays intact for the next loop.
+func (f *faultInjector) modify(unit []byte) []byte {
+	if f.truncate > 0 {
+		f.truncate--
+		return unit[:len(unit)/2]
+	}
+	if f.corrupt > 0 {
+		f.corrupt--
+		corrupted := make([]byte, len(unit))
+		copy(corrupted, unit)
+		// keep the header, garble the payload
+		for i := mp3.HEADER_SIZE; i < len(corrupted); i += 1 + rand.IntN(16) {
+			corrupted[i] = byte(rand.UintN(256))
+		}
+		return corrupted
+	}
+	return unit
+}
+
+func (f *faultInjector) log(now time.Time, logs ...any) {
+	params := append([]any{f.channelName, "fault at", now.UTC().Format(time.RFC3339Nano) + ":"}, logs...)
+	log.Warn(params...)
+}
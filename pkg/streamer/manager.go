@@ -0,0 +1,257 @@
+package streamer
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+)
+
+var (
+	ErrUnknownChannel = errors.New("unknown channel")
+	ErrChannelRunning = errors.New("channel is running")
+	ErrChannelStopped = errors.New("channel is stopped")
+	ErrInvalidIndex   = errors.New("invalid playlist index")
+)
+
+// Manager runs one channel per stream config and applies config changes.
+type Manager struct {
+	metrics util.MetricsControl
+	verbose bool
+
+	// serializes config changes
+	applyMu sync.Mutex
+
+	mu       sync.Mutex
+	channels map[string]*Channel
+	// channels stopped by Stop
+	stopped map[string]bool
+}
+
+func NewManager(metrics util.MetricsControl, verbose bool) *Manager {
+	return &Manager{metrics: metrics, verbose: verbose, channels: map[string]*Channel{}, stopped: map[string]bool{}}
+}
+
+// Apply diffs config against the running channels. New channels are started
+// and removed ones stopped. Playlist and metadata changes are applied to
+// running channels at the next item boundary. Channels with changed audio
+// settings are restarted, as this needs a new connection. Channels stopped
+// by Stop stay stopped. Channels are stopped without holding the lock, as
+// stopping waits for the connection to close.
+func (m *Manager) Apply(config configmanager.StreamsConfig) {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+
+	stop, restart := m.diff(config)
+	for _, channel := range stop {
+		channel.Stop()
+		newChannelMetrics(m.metrics, channel.Name).unregister()
+	}
+	for channel, item := range restart {
+		channel.Stop()
+		m.mu.Lock()
+		// a channel changed in between keeps its state
+		if m.channels[channel.Name] == channel {
+			m.start(item)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// diff applies config to the channel map and returns the channels to stop and
+// the channels to restart with their new config.
+func (m *Manager) diff(config configmanager.StreamsConfig) ([]*Channel, map[*Channel]configmanager.StreamConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := map[string]configmanager.StreamConfig{}
+	for _, item := range config.Items {
+		wanted[item.ChannelName] = item
+	}
+
+	// stop removed
+	stop := []*Channel{}
+	for name, channel := range m.channels {
+		if _, ok := wanted[name]; !ok {
+			log.Info(name, "removed, stop channel")
+			stop = append(stop, channel)
+			delete(m.channels, name)
+			delete(m.stopped, name)
+		}
+	}
+
+	restart := map[*Channel]configmanager.StreamConfig{}
+	for _, item := range config.Items {
+		channel, ok := m.channels[item.ChannelName]
+		if !ok {
+			log.Info(item.ChannelName, "added, start channel")
+			m.start(item)
+			continue
+		}
+
+		running := channel.Config()
+		if reflect.DeepEqual(running, item) {
+			continue
+		}
+		if !channel.Running() {
+			log.Info(item.ChannelName, "changed, update stopped channel")
+			m.channels[item.ChannelName] = NewChannel(item, m.metrics, m.verbose)
+			continue
+		}
+		if !reflect.DeepEqual(running.Audio, item.Audio) {
+			log.Info(item.ChannelName, "audio changed, restart channel")
+			restart[channel] = item
+			continue
+		}
+		log.Info(item.ChannelName, "changed, update at next item")
+		channel.Update(item)
+	}
+	return stop, restart
+}
+
+func (m *Manager) start(config configmanager.StreamConfig) {
+	channel := NewChannel(config, m.metrics, m.verbose)
+	m.channels[config.ChannelName] = channel
+	channel.Start()
+}
+
+// control
+
+// Channel returns the channel with name or nil.
+func (m *Manager) Channel(name string) *Channel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.channels[name]
+}
+
+// Channels returns all channels sorted by name.
+func (m *Manager) Channels() []*Channel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channels := make([]*Channel, 0, len(m.channels))
+	for _, channel := range m.channels {
+		channels = append(channels, channel)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels
+}
+
+func (m *Manager) Start(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channel, ok := m.channels[name]
+	if !ok {
+		return ErrUnknownChannel
+	}
+	if channel.Running() {
+		return ErrChannelRunning
+	}
+	log.Info(name, "start channel")
+	delete(m.stopped, name)
+	m.start(channel.Config())
+	return nil
+}
+
+// Stop stops the channel on purpose, it stays ready until started again.
+func (m *Manager) Stop(name string) error {
+	channel, err := m.runningChannel(name)
+	if err != nil {
+		return err
+	}
+	log.Info(name, "stop channel")
+	m.mu.Lock()
+	m.stopped[name] = true
+	m.mu.Unlock()
+	channel.Stop()
+	return nil
+}
+
+func (m *Manager) Skip(name string) error {
+	channel, err := m.runningChannel(name)
+	if err != nil {
+		return err
+	}
+	channel.Skip()
+	return nil
+}
+
+func (m *Manager) Jump(name string, index int) error {
+	channel, err := m.runningChannel(name)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(channel.Config().Playlist.Items) {
+		return ErrInvalidIndex
+	}
+	channel.Jump(index)
+	return nil
+}
+
+func (m *Manager) PushMetadata(name string) error {
+	channel, err := m.runningChannel(name)
+	if err != nil {
+		return err
+	}
+	return channel.PushMetadata()
+}
+
+func (m *Manager) NowPlaying(name string) (NowPlaying, error) {
+	channel, err := m.runningChannel(name)
+	if err != nil {
+		return NowPlaying{}, err
+	}
+	return channel.NowPlaying()
+}
+
+func (m *Manager) SubscribeNowPlaying(name string) (<-chan NowPlaying, func(), error) {
+	channel, err := m.runningChannel(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	updates, unsubscribe := channel.SubscribeNowPlaying()
+	return updates, unsubscribe, nil
+}
+
+// Readiness reports a channel ready, if it is connected or was stopped on
+// purpose by Stop.
+func (m *Manager) Readiness() map[string]metricmanager.Check {
+	checks := map[string]metricmanager.Check{}
+	for _, channel := range m.Channels() {
+		status := channel.Status()
+		ready := status.State == StateStreaming || status.State == StateFallback
+		if status.State == StateStopped && m.stoppedOnPurpose(channel.Name) {
+			ready = true
+		}
+		checks[channel.Name] = metricmanager.Check{Ready: ready, Detail: status.State}
+	}
+	return checks
+}
+
+func (m *Manager) stoppedOnPurpose(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stopped[name]
+}
+
+// StopAll stops all channels, e.g. on shutdown.
+func (m *Manager) StopAll() {
+	for _, channel := range m.Channels() {
+		channel.Stop()
+	}
+}
+
+func (m *Manager) runningChannel(name string) (*Channel, error) {
+	channel := m.Channel(name)
+	if channel == nil {
+		return nil, ErrUnknownChannel
+	}
+	if !channel.Running() {
+		return nil, ErrChannelStopped
+	}
+	return channel, nil
+}
@@ -0,0 +1,39 @@
+package streamer
+
+import (
+	"testing"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+func TestReadinessStopped(t *testing.T) {
+	m := NewManager(util.MetricsControl{}, false)
+	for _, name := range []string{"failed", "paused"} {
+		m.channels[name] = NewChannel(configmanager.StreamConfig{ChannelName: name}, util.MetricsControl{}, false)
+	}
+	// paused is running until stopped by the control api
+	paused := m.channels["paused"]
+	paused.running = true
+	close(paused.done)
+	if err := m.Stop("paused"); err != nil {
+		t.Fatal(err)
+	}
+	paused.running = false
+
+	checks := m.Readiness()
+	if checks["failed"].Ready {
+		t.Errorf("failed channel: got ready, want not ready")
+	}
+	if !checks["paused"].Ready || checks["paused"].Detail != StateStopped {
+		t.Errorf("channel stopped on purpose: got %+v, want ready", checks["paused"])
+	}
+
+	if err := m.Start("paused"); err != nil {
+		t.Fatal(err)
+	}
+	m.channels["paused"].Stop()
+	if m.Readiness()["paused"].Ready {
+		t.Errorf("restarted channel: got ready after it stopped")
+	}
+}
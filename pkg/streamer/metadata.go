@@ -0,0 +1,194 @@
+package streamer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/metadata"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+	"github.com/nice-pink/streamey/pkg/template"
+)
+
+// metaSinks delivers metadata to all sinks of a channel. Every sink has its
+// own sender, so a slow sink doesn't delay the others.
+type metaSinks struct {
+	channelName string
+	metrics     util.MetricsControl
+
+	mu      sync.Mutex
+	sinks   []configmanager.MetadataSink
+	senders map[string]*metadata.Sender
+	capture *metadata.Capture
+}
+
+func newMetaSinks(config configmanager.StreamConfig, metrics util.MetricsControl) *metaSinks {
+	m := &metaSinks{channelName: config.ChannelName, metrics: metrics, senders: map[string]*metadata.Sender{}}
+	m.configure(config)
+	return m
+}
+
+// configure starts senders of new sinks and stops removed ones.
+func (m *metaSinks) configure(config configmanager.StreamConfig) {
+	sinks := config.Metadata.GetSinks(config.Playlist.ContentType)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.configureCapture(config.Metadata.CaptureFile)
+	current := map[string]bool{}
+	for _, sink := range sinks {
+		current[sink.Name] = true
+		if schema := sink.Validation.JsonSchema; schema != "" && !sink.Validation.Disabled {
+			if _, err := metadata.LoadSchema(schema); err != nil {
+				log.Err(err, m.channelName, "cannot read json schema of sink", sink.Name)
+			}
+		}
+		if sender, ok := m.senders[sink.Name]; ok {
+			sender.Configure(sink)
+			continue
+		}
+		metrics := metricmanager.WithLabel(m.metrics, "sink", sink.Name)
+		m.senders[sink.Name] = metadata.NewSender(m.channelName+"/"+sink.Name, sink, metrics)
+		m.senders[sink.Name].SetCapture(m.capture)
+	}
+	for name, sender := range m.senders {
+		if !current[name] {
+			sender.Close()
+			delete(m.senders, name)
+		}
+	}
+	m.sinks = sinks
+}
+
+// configureCapture reopens the capture, if file changed.
+func (m *metaSinks) configureCapture(file string) {
+	if m.capture != nil && m.capture.File() == file {
+		return
+	}
+	if m.capture != nil {
+		m.capture.Close()
+		m.capture = nil
+	}
+	if file != "" {
+		capture, err := metadata.NewCapture(file)
+		if err != nil {
+			log.Err(err, m.channelName, "cannot capture metadata")
+		}
+		m.capture = capture
+	}
+	for _, sender := range m.senders {
+		sender.SetCapture(m.capture)
+	}
+}
+
+// send renders and sends info to all sinks at time at. The result is nil if
+// all sinks got it, the first failure or ErrSpooled. It is nil if there are
+// no sinks.
+func (m *metaSinks) send(info template.TrackInfo, at time.Time) (<-chan error, func() bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sinks) == 0 {
+		return nil, noCancel
+	}
+
+	results := []<-chan error{}
+	cancels := []func() bool{}
+	for _, sink := range m.sinks {
+		event, err := metadata.GetEvent(sink, info)
+		if err != nil {
+			log.Err(err, m.channelName, "metadata not sent to sink", sink.Name)
+			results = append(results, result(err))
+			continue
+		}
+		if event == nil {
+			continue
+		}
+		r, cancel := m.senders[sink.Name].SendAt(*event, at)
+		results = append(results, r)
+		cancels = append(cancels, cancel)
+	}
+
+	cancel := func() bool {
+		canceled := false
+		for _, cancel := range cancels {
+			canceled = cancel() || canceled
+		}
+		return canceled
+	}
+	return combine(results), cancel
+}
+
+func (m *metaSinks) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, sender := range m.senders {
+		sender.Close()
+		delete(m.senders, name)
+	}
+	if m.capture != nil {
+		m.capture.Close()
+		m.capture = nil
+	}
+}
+
+// combine waits for all results. Failures are reported before spooled events.
+func combine(results []<-chan error) <-chan error {
+	combined := make(chan error, 1)
+	go func() {
+		var spooled, failed error
+		for _, r := range results {
+			err := <-r
+			switch {
+			case err == nil:
+			case errors.Is(err, metadata.ErrSpooled):
+				spooled = err
+			case failed == nil:
+				failed = err
+			}
+		}
+		if failed != nil {
+			combined <- failed
+			return
+		}
+		combined <- spooled
+	}()
+	return combined
+}
+
+// scheduledMeta is metadata of the item at index, sent ahead at.
+type scheduledMeta struct {
+	index  int
+	at     time.Time
+	result <-chan error
+	cancel func() bool
+}
+
+func noCancel() bool {
+	return false
+}
+
+// channelTrackInfo returns the template data of item at index, which plays
+// for duration from start.
+func channelTrackInfo(config configmanager.StreamConfig, item configmanager.PlaylistItem, index int, loops int, sequence int64, start time.Time, duration time.Duration) template.TrackInfo {
+	info := metadata.GetChannelTrackInfo(config, item, index, loops, sequence, start)
+	info.Duration = duration.Seconds()
+	info.Stop = start.Add(duration)
+	return info
+}
+
+// shift moves start and stop of info by offset.
+func shift(info template.TrackInfo, offset time.Duration) template.TrackInfo {
+	info.Start = info.Start.Add(offset)
+	info.Stop = info.Stop.Add(offset)
+	return info
+}
+
+// result returns a result channel with err.
+func result(err error) <-chan error {
+	c := make(chan error, 1)
+	c <- err
+	return c
+}
@@ -0,0 +1,85 @@
+package streamer
+
+import (
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/nice-pink/streamey/pkg/metricmanager"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const RATE_WINDOW time.Duration = 5 * time.Second
+
+// channelMetrics are labelled by channel name.
+type channelMetrics struct {
+	bytesSent       prometheus.Counter
+	framesSent      prometheus.Counter
+	sendRate        prometheus.Gauge
+	targetRate      prometheus.Gauge
+	reconnects      prometheus.Counter
+	connected       prometheus.Gauge
+	itemIndex       prometheus.Gauge
+	loops           prometheus.Counter
+	fallbackSeconds prometheus.Counter
+	fallbackSkipped prometheus.Counter
+
+	// send rate window
+	windowStart time.Time
+	windowBytes int
+}
+
+func newChannelMetrics(control util.MetricsControl, channelName string) *channelMetrics {
+	control = metricmanager.WithLabel(control, "channel", channelName)
+	return &channelMetrics{
+		bytesSent:       metricmanager.NewCounter(control, "bytes_sent_total", "Bytes sent."),
+		framesSent:      metricmanager.NewCounter(control, "frames_sent_total", "Audio frames sent."),
+		sendRate:        metricmanager.NewGauge(control, "send_rate_bits", "Actual send rate in bit/s."),
+		targetRate:      metricmanager.NewGauge(control, "target_rate_bits", "Target send rate in bit/s."),
+		reconnects:      metricmanager.NewCounter(control, "reconnects_total", "Reconnects after connection loss."),
+		connected:       metricmanager.NewGauge(control, "connected", "1 if connected."),
+		itemIndex:       metricmanager.NewGauge(control, "item_index", "Playlist index of the current item."),
+		loops:           metricmanager.NewCounter(control, "playlist_loops_total", "Completed playlist loops."),
+		fallbackSeconds: metricmanager.NewCounter(control, "fallback_seconds_total", "Seconds of silence streamed as fallback."),
+		fallbackSkipped: metricmanager.NewCounter(control, "fallback_skipped_total", "Fallbacks without silence, as the channel streams no mp3."),
+	}
+}
+
+// sent counts a sent unit and updates the send rate once per window.
+func (m *channelMetrics) sent(bytes int, isFrame bool) {
+	m.bytesSent.Add(float64(bytes))
+	if isFrame {
+		m.framesSent.Inc()
+	}
+
+	now := time.Now()
+	if m.windowStart.IsZero() {
+		m.windowStart = now
+	}
+	m.windowBytes += bytes
+	elapsed := now.Sub(m.windowStart)
+	if elapsed >= RATE_WINDOW {
+		m.sendRate.Set(float64(m.windowBytes*8) / elapsed.Seconds())
+		m.windowStart = now
+		m.windowBytes = 0
+	}
+}
+
+func (m *channelMetrics) setConnected(connected bool) {
+	if connected {
+		m.connected.Set(1)
+	} else {
+		m.connected.Set(0)
+		m.sendRate.Set(0)
+		m.windowStart = time.Time{}
+		m.windowBytes = 0
+	}
+}
+
+// unregister removes the metrics of the channel, e.g. when it was removed from
+// the config.
+func (m *channelMetrics) unregister() {
+	collectors := []prometheus.Collector{m.bytesSent, m.framesSent, m.sendRate, m.targetRate, m.reconnects, m.connected, m.itemIndex, m.loops, m.fallbackSeconds, m.fallbackSkipped}
+	for _, collector := range collectors {
+		prometheus.Unregister(collector)
+	}
+}
@@ -0,0 +1,31 @@
+package streamer
+
+import (
+	"testing"
+
+	"github.com/nice-pink/audio-tool/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestChannelMetricsRemoved(t *testing.T) {
+	control := util.MetricsControl{Enabled: true, Prefix: "test_"}
+	metrics := newChannelMetrics(control, "removed")
+	metrics.setConnected(true)
+	metrics.sendRate.Set(128000)
+	metrics.setConnected(false)
+	if connected, rate := testutil.ToFloat64(metrics.connected), testutil.ToFloat64(metrics.sendRate); connected != 0 || rate != 0 {
+		t.Errorf("disconnected: got connected %f, rate %f", connected, rate)
+	}
+
+	newChannelMetrics(control, "removed").unregister()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "test_connected" {
+			t.Errorf("metrics of removed channel: %v", family)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package streamer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/template"
+)
+
+// NowPlaying is the current and next item of a channel with the data of the
+// metadata templates.
+type NowPlaying struct {
+	Channel   string
+	Current   template.TrackInfo
+	Next      *template.TrackInfo
+	Remaining time.Duration
+}
+
+// nowPlaying keeps the current and next item and notifies subscribers on
+// every item change.
+type nowPlaying struct {
+	mu          sync.Mutex
+	current     template.TrackInfo
+	next        *template.TrackInfo
+	subscribers map[chan NowPlaying]bool
+	closed      bool
+}
+
+func newNowPlaying() *nowPlaying {
+	return &nowPlaying{subscribers: map[chan NowPlaying]bool{}}
+}
+
+// set starts current. next is the following playlist item.
+func (n *nowPlaying) set(channelName string, current template.TrackInfo, next template.TrackInfo) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.current = current
+	n.next = &next
+	playing := n.state(channelName)
+	for subscriber := range n.subscribers {
+		// drop an unread older state
+		select {
+		case <-subscriber:
+		default:
+		}
+		subscriber <- playing
+	}
+}
+
+// close closes all subscriptions, when the channel stopped.
+func (n *nowPlaying) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.closed = true
+	for subscriber := range n.subscribers {
+		delete(n.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+func (n *nowPlaying) get(channelName string) (NowPlaying, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	// next is set with the first item
+	if n.next == nil {
+		return NowPlaying{}, ErrNotPlaying
+	}
+	return n.state(channelName), nil
+}
+
+func (n *nowPlaying) state(channelName string) NowPlaying {
+	return NowPlaying{Channel: channelName, Current: n.current, Next: n.next, Remaining: max(time.Until(n.current.Stop), 0)}
+}
+
+// subscribe returns a channel with the latest state. The channel is closed
+// by unsubscribe or when the channel stopped.
+func (n *nowPlaying) subscribe() (<-chan NowPlaying, func()) {
+	subscriber := make(chan NowPlaying, 1)
+	n.mu.Lock()
+	if n.closed {
+		close(subscriber)
+	} else {
+		n.subscribers[subscriber] = true
+	}
+	n.mu.Unlock()
+
+	unsubscribe := func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if n.subscribers[subscriber] {
+			delete(n.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	return subscriber, unsubscribe
+}
@@ -0,0 +1,48 @@
+package streamer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+func TestNowPlaying(t *testing.T) {
+	n := newNowPlaying()
+	if _, err := n.get("test"); err != ErrNotPlaying {
+		t.Errorf("before first item: got %v, want %v", err, ErrNotPlaying)
+	}
+	updates, unsubscribe := n.subscribe()
+	defer unsubscribe()
+
+	config := configmanager.StreamConfig{ChannelName: "test", Playlist: configmanager.Playlist{Items: []configmanager.PlaylistItem{
+		{Artist: "A", Title: "1", Duration: 10},
+		{Artist: "A", Title: "2", Duration: 20},
+	}}}
+	now := time.Now()
+	first := channelTrackInfo(config, config.Playlist.Items[0], 0, 0, 1, now, 10*time.Second)
+	second := channelTrackInfo(config, config.Playlist.Items[1], 1, 0, 2, now, 20*time.Second)
+	n.set("test", first, second)
+	n.set("test", second, channelTrackInfo(config, config.Playlist.Items[0], 0, 1, 3, second.Stop, 10*time.Second))
+
+	// only the latest state is kept for slow subscribers
+	playing := <-updates
+	if playing.Current.Title != "2" || playing.Next.Title != "1" {
+		t.Errorf("got %s next %s", playing.Current.Title, playing.Next.Title)
+	}
+	if !playing.Next.Start.Equal(playing.Current.Stop) || playing.Current.Duration != 20 || playing.Next.Id != "3" || playing.Next.LoopCount != 1 {
+		t.Errorf("times: %+v", playing)
+	}
+	if playing.Remaining <= 19*time.Second || playing.Remaining > 20*time.Second {
+		t.Errorf("remaining: got %v", playing.Remaining)
+	}
+
+	n.close()
+	if _, ok := <-updates; ok {
+		t.Error("subscription not closed on stop")
+	}
+	late, _ := n.subscribe()
+	if _, ok := <-late; ok {
+		t.Error("subscription after stop not closed")
+	}
+}
@@ -0,0 +1,132 @@
+package streamer
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+const (
+	RampUpLinear string = "linear"
+	RampUpStep   string = "step"
+)
+
+// pacer schedules sending, so that data leaves at bitrate times rate factor.
+// After every reset the configured burst is due at once and the rate ramps up.
+// It replaces the pacing of connection.StreamBuffer, which has no burst, ramp
+// up or rate factor and can't be changed here.
+type pacer struct {
+	bitrate   float64
+	factor    float64
+	ramp      float64
+	buffer    configmanager.BufferConfig
+	connected time.Time
+	base      time.Time
+	sent      int
+	stop      <-chan struct{}
+}
+
+func newPacer(bitrate float64, buffer configmanager.BufferConfig, stop <-chan struct{}) *pacer {
+	p := &pacer{bitrate: bitrate, factor: 1, ramp: 1, buffer: buffer, stop: stop}
+	p.reset()
+	return p
+}
+
+// wait blocks until the next byte is due.
+func (p *pacer) wait() {
+	sleep(time.Until(p.due()), p.stop)
+}
+
+func (p *pacer) due() time.Time {
+	sec := float64(p.sent*8) / p.rate()
+	return p.base.Add(time.Duration(sec * float64(time.Second)))
+}
+
+// rate returns the current send rate in bit/s.
+func (p *pacer) rate() float64 {
+	return p.bitrate * p.factor * p.ramp
+}
+
+func (p *pacer) add(n int) {
+	p.sent += n
+}
+
+// reset starts a new schedule now, e.g. after a reconnect. The schedule starts
+// burst seconds in the past, so the burst is due immediately.
+func (p *pacer) reset() {
+	now := time.Now()
+	burst := time.Duration(p.buffer.BurstSec * float64(time.Second))
+	p.connected = now
+	p.base = now.Add(-burst)
+	p.sent = 0
+	p.ramp = p.rampFactor(now)
+}
+
+// setFactor changes the send rate relative to bitrate from now on.
+func (p *pacer) setFactor(factor float64) {
+	if factor <= 0 || factor == p.factor {
+		return
+	}
+	p.rebase()
+	p.factor = factor
+}
+
+// rampUp updates the ramp up factor for now.
+func (p *pacer) rampUp(now time.Time) {
+	ramp := p.rampFactor(now)
+	if ramp == p.ramp {
+		return
+	}
+	p.rebase()
+	p.ramp = ramp
+}
+
+func (p *pacer) rampFactor(now time.Time) float64 {
+	b := p.buffer
+	if b.RampUpSec <= 0 || b.RampUpFactor <= 0 {
+		return 1
+	}
+	elapsed := now.Sub(p.connected).Seconds()
+	if elapsed >= b.RampUpSec {
+		return 1
+	}
+	if strings.ToLower(b.RampUpProfile) == RampUpStep {
+		return b.RampUpFactor
+	}
+	return b.RampUpFactor + (1-b.RampUpFactor)*elapsed/b.RampUpSec
+}
+
+// rebase keeps the schedule so far, before the rate changes.
+func (p *pacer) rebase() {
+	p.base = p.due()
+	p.sent = 0
+}
+
+// pause delays the schedule, so nothing is caught up afterwards.
+func (p *pacer) pause(d time.Duration) {
+	sleep(d, p.stop)
+	p.base = p.base.Add(d)
+}
+
+// sleep returns after d or as soon as stop is closed.
+func sleep(d time.Duration, stop <-chan struct{}) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-stop:
+	}
+}
+
+func closed(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
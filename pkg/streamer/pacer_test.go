@@ -0,0 +1,58 @@
+package streamer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nice-pink/streamey/pkg/configmanager"
+)
+
+func TestPacerBurst(t *testing.T) {
+	p := newPacer(128000, configmanager.BufferConfig{BurstSec: 2}, nil)
+
+	// 2 seconds of audio are due at once
+	p.add(2 * 128000 / 8)
+	if time.Until(p.due()) > 10*time.Millisecond {
+		t.Errorf("burst not due: %v", time.Until(p.due()))
+	}
+	p.add(128000 / 8)
+	if wait := time.Until(p.due()); wait < 900*time.Millisecond || wait > time.Second {
+		t.Errorf("after burst: got %v, want 1s", wait)
+	}
+}
+
+func TestPacerRampUp(t *testing.T) {
+	p := newPacer(128000, configmanager.BufferConfig{RampUpSec: 10, RampUpFactor: 2}, nil)
+	start := p.connected
+
+	if p.rate() != 256000 {
+		t.Errorf("start rate: got %v", p.rate())
+	}
+	p.rampUp(start.Add(5 * time.Second))
+	if p.rate() != 192000 {
+		t.Errorf("linear rate: got %v", p.rate())
+	}
+	p.rampUp(start.Add(10 * time.Second))
+	if p.rate() != 128000 {
+		t.Errorf("end rate: got %v", p.rate())
+	}
+
+	p.buffer.RampUpProfile = RampUpStep
+	if f := p.rampFactor(start.Add(9 * time.Second)); f != 2 {
+		t.Errorf("step factor: got %v", f)
+	}
+}
+
+func TestBufferNeedsPacing(t *testing.T) {
+	config := configmanager.StreamConfig{ChannelName: "test"}
+	s := &sender{}
+	s.configure(config)
+	if s.needsPacing() {
+		t.Error("without buffer settings: got paced, want StreamBuffer")
+	}
+	config.Buffer = configmanager.BufferConfig{BurstSec: 2}
+	s.configure(config)
+	if !s.needsPacing() {
+		t.Error("with burst: got StreamBuffer, want paced")
+	}
+}
@@ -0,0 +1,290 @@
+package streamer
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/nice-pink/audio-tool/pkg/network"
+	"github.com/nice-pink/goutil/pkg/log"
+	"github.com/nice-pink/streamey/pkg/configmanager"
+	"github.com/nice-pink/streamey/pkg/marker"
+	"github.com/nice-pink/streamey/pkg/mp3"
+)
+
+const (
+	RECONNECT_DELAY     time.Duration = 2 * time.Second
+	MARKER_INTERVAL_SEC float64       = 10
+	SKIP_POLL_INTERVAL  time.Duration = 100 * time.Millisecond
+)
+
+// unit is a part of the buffer which is sent at once.
+type unit struct {
+	start   int
+	end     int
+	isFrame bool
+}
+
+// sender streams items of a channel. Without markers, faults and buffer
+// settings items are streamed by connection.StreamBuffer. Otherwise the
+// sender paces and writes every frame itself.
+type sender struct {
+	channelName string
+	connection  *network.Connection
+	initFn      func() error
+	initialised net.Conn
+	bitrate     float64
+	paced       bool
+	marker      *markerWriter
+	faults      *faultInjector
+	buffer      configmanager.BufferConfig
+	pacer       *pacer
+	stop        <-chan struct{}
+	skip        *atomic.Bool
+	connected   atomic.Bool
+	metrics     *channelMetrics
+	verbose     bool
+}
+
+func newSender(config configmanager.StreamConfig, connection *network.Connection, initFn func() error, stop <-chan struct{}, skip *atomic.Bool, metrics *channelMetrics, verbose bool) *sender {
+	s := &sender{channelName: config.ChannelName, connection: connection, initFn: initFn, stop: stop, skip: skip, metrics: metrics, verbose: verbose}
+	s.configure(config)
+	return s
+}
+
+// configure applies marker, fault and buffer settings of config. Buffer
+// settings apply from the next reconnect.
+func (s *sender) configure(config configmanager.StreamConfig) {
+	s.buffer = config.Buffer
+	if s.pacer != nil {
+		s.pacer.buffer = config.Buffer
+	}
+	s.marker = nil
+	if config.Marker.Enabled {
+		s.marker = newMarkerWriter(config.ChannelName, config.Marker.IntervalSec)
+	}
+	s.faults = newFaultInjector(config.ChannelName, config.Faults)
+}
+
+// open connects and starts pacing by bitrate.
+func (s *sender) open(bitrate float64) {
+	s.bitrate = bitrate
+	s.pacer = newPacer(bitrate, s.buffer, s.stop)
+	s.connect()
+	s.pacer.reset()
+}
+
+// needsPacing returns true if markers, faults or buffer settings need the
+// pacing of the sender.
+func (s *sender) needsPacing() bool {
+	return s.marker != nil || s.faults != nil || s.buffer.Enabled()
+}
+
+// send sends data once and reconnects on any interruption. It returns early,
+// if the sender is stopped or the item is skipped. Returns the bytes sent.
+func (s *sender) send(data []byte) int {
+	if !s.needsPacing() {
+		s.paced = false
+		return s.streamBuffer(data)
+	}
+	if !s.paced {
+		// the schedule starts now, after items of StreamBuffer
+		s.paced = true
+		s.pacer.reset()
+	}
+	p := s.pacer
+	sent := 0
+	for _, u := range getUnits(data) {
+		if s.stopped() || s.skip.CompareAndSwap(true, false) {
+			return sent
+		}
+		chunk := data[u.start:u.end]
+
+		if s.faults != nil && s.faults.before(p) {
+			s.reconnect(p)
+		}
+		p.rampUp(time.Now())
+		s.metrics.targetRate.Set(p.rate())
+		p.wait()
+
+		if s.marker != nil && u.isFrame {
+			s.marker.mark(chunk, time.Now())
+		}
+		if s.faults != nil {
+			chunk = s.faults.modify(chunk)
+		}
+		if err := s.write(chunk); err != nil {
+			log.Err(err, s.channelName, "write failed, reconnect")
+			s.reconnect(p)
+			continue
+		}
+		p.add(len(chunk))
+		sent += len(chunk)
+		s.metrics.sent(len(chunk), u.isFrame)
+	}
+	return sent
+}
+
+func (s *sender) reconnect(p *pacer) {
+	s.connected.Store(false)
+	s.metrics.setConnected(false)
+	s.metrics.reconnects.Inc()
+	s.connection.Close()
+	s.connect()
+	p.reset()
+}
+
+func (s *sender) write(chunk []byte) error {
+	conn, err := s.connection.GetSocketConn()
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(chunk)
+	return err
+}
+
+// streamBuffer sends data once with connection.StreamBuffer, which reconnects
+// by itself. StreamBuffer loops over data until stopped, so it's stopped at
+// the start of the second loop, on skip or when the sender stops. Returns the
+// bytes sent, estimated by bitrate if data was interrupted.
+func (s *sender) streamBuffer(data []byte) int {
+	stop := make(chan bool, 1)
+	stopStream := func() {
+		select {
+		case stop <- true:
+		default:
+		}
+	}
+	var interrupted atomic.Bool
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(SKIP_POLL_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-s.stop:
+			case <-ticker.C:
+				if !s.skip.CompareAndSwap(true, false) {
+					continue
+				}
+			}
+			interrupted.Store(true)
+			stopStream()
+			return
+		}
+	}()
+	loopFn := func(loop int) error {
+		if loop > 0 {
+			stopStream()
+		}
+		return nil
+	}
+
+	s.metrics.targetRate.Set(s.bitrate)
+	start := time.Now()
+	s.connection.StreamBuffer(data, s.bitrate, CHUNK_SIZE, true, s.initOnce, loopFn, stop)
+	sent := len(data)
+	if interrupted.Load() {
+		sent = min(sent, int(time.Since(start).Seconds()*s.bitrate/8))
+	}
+	s.metrics.sent(sent, false)
+	return sent
+}
+
+// initOnce initialises every socket connection once, as StreamBuffer calls
+// initFn for every buffer.
+func (s *sender) initOnce() error {
+	conn, err := s.connection.GetSocketConn()
+	if err != nil {
+		return err
+	}
+	if s.initFn == nil || (s.initialised != nil && conn == s.initialised) {
+		return nil
+	}
+	if err := s.initFn(); err != nil {
+		return err
+	}
+	s.initialised = conn
+	return nil
+}
+
+// connect blocks until the connection is established and initialised.
+func (s *sender) connect() {
+	for !s.stopped() {
+		err := s.initOnce()
+		if err == nil {
+			if s.marker != nil {
+				s.marker.reset()
+			}
+			s.connected.Store(true)
+			s.metrics.setConnected(true)
+			return
+		}
+		log.Err(err, s.channelName, "connect failed, retry in", RECONNECT_DELAY)
+		s.connection.Close()
+		sleep(RECONNECT_DELAY, s.stop)
+	}
+}
+
+func (s *sender) stopped() bool {
+	return closed(s.stop)
+}
+
+func getUnits(data []byte) []unit {
+	units := []unit{}
+	for _, frame := range mp3.Frames(data) {
+		units = append(units, unit{start: frame.Offset, end: frame.End(), isFrame: true})
+	}
+	if len(units) > 0 {
+		return units
+	}
+
+	// no frames, send chunks
+	for start := 0; start < len(data); start += CHUNK_SIZE {
+		units = append(units, unit{start: start, end: min(start+CHUNK_SIZE, len(data))})
+	}
+	return units
+}
+
+// marker
+
+type markerWriter struct {
+	channelName string
+	interval    time.Duration
+	next        time.Time
+	bits        []bool
+}
+
+func newMarkerWriter(channelName string, intervalSec float64) *markerWriter {
+	if intervalSec <= 0 {
+		intervalSec = MARKER_INTERVAL_SEC
+	}
+	return &markerWriter{channelName: channelName, interval: time.Duration(intervalSec * float64(time.Second))}
+}
+
+// mark sets the copyright bit of the frame which is sent now. A new marker
+// starts once the interval passed since the last one.
+func (m *markerWriter) mark(frame []byte, now time.Time) {
+	if len(m.bits) == 0 && !now.Before(m.next) {
+		id := marker.IdFromTime(now)
+		m.bits = marker.Encode(id)
+		m.next = now.Add(m.interval)
+		log.Info(m.channelName, "marker", id, "sent", now.UTC().Format(time.RFC3339Nano))
+	}
+
+	bit := false
+	if len(m.bits) > 0 {
+		bit = m.bits[0]
+		m.bits = m.bits[1:]
+	}
+	mp3.SetCopyright(frame, bit)
+}
+
+// reset drops an incomplete marker, as the receiver can't decode it anyway.
+func (m *markerWriter) reset() {
+	m.bits = nil
+	m.next = time.Time{}
+}
@@ -1,11 +1,42 @@
 package template
 
+import "time"
+
+// TrackInfo is the data of metadata templates. Id is the play sequence of
+// the channel as string.
 type TrackInfo struct {
-	Uuid     string
-	Id       string
+	Uuid        string
+	Id          string
+	Sequence    int64
+	Title       string
+	Artist      string
+	Album       string
+	Filepath    string
+	Duration    float64
+	TypeId      string
+	TypeName    string
+	Custom      map[string]string
+	LastStarted bool
+	Start       time.Time
+	Stop        time.Time
+
+	ChannelName string
+	LoopCount   int
+	ItemIndex   int
+	Bitrate     int
+	SampleRate  int
+	Previous    ItemInfo
+	Next        ItemInfo
+}
+
+// ItemInfo is a neighbouring playlist item.
+type ItemInfo struct {
 	Title    string
 	Artist   string
-	Duration float32
+	Album    string
+	Filepath string
+	Duration float64
 	TypeId   string
 	TypeName string
+	Custom   map[string]string
 }
@@ -0,0 +1,166 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	UTC_FORMAT string = "2006-01-02T15:04:05Z"
+	ISO_FORMAT string = "02.01.2006 15:04:05"
+
+	// {{ custom_<key> }} is the custom field key of the item
+	CUSTOM_PREFIX string = "custom_"
+)
+
+// legacy placeholders like {{ artist }} and their template expressions
+var (
+	legacyPattern = regexp.MustCompile(`\{\{\s*([a-z_]+[a-zA-Z0-9_]*)\s*\}\}`)
+	legacyFields  = map[string]string{
+		"type_name":    ".TypeName",
+		"type_id":      ".TypeId",
+		"uuid":         ".Uuid",
+		"id":           ".Id",
+		"artist":       ".Artist",
+		"title":        ".Title",
+		"album":        ".Album",
+		"filepath":     ".Filepath",
+		"last_started": ".LastStarted",
+		"duration":     `printf "%.3f" .Duration`,
+		"start_utc":    `.Start | utc | format "` + UTC_FORMAT + `"`,
+		"start_iso":    `.Start | utc | format "` + ISO_FORMAT + `"`,
+		"stop_utc":     `.Stop | utc | format "` + UTC_FORMAT + `"`,
+		"stop_iso":     `.Stop | utc | format "` + ISO_FORMAT + `"`,
+		"sequence":     ".Sequence",
+		"channel_name": ".ChannelName",
+		"loop_count":   ".LoopCount",
+		"item_index":   ".ItemIndex",
+		"bitrate":      ".Bitrate",
+		"sample_rate":  ".SampleRate",
+		"next_artist":  ".Next.Artist",
+		"next_title":   ".Next.Title",
+		"next_type_id": ".Next.TypeId",
+		"prev_artist":  ".Previous.Artist",
+		"prev_title":   ".Previous.Title",
+		"prev_type_id": ".Previous.TypeId",
+	}
+	// keywords and builtin functions of text/template, they are no placeholders
+	templateNames = map[string]bool{
+		"end": true, "else": true, "break": true, "continue": true, "nil": true, "true": true, "false": true,
+		"and": true, "or": true, "not": true, "call": true, "index": true, "slice": true, "len": true,
+		"print": true, "printf": true, "println": true, "html": true, "js": true, "urlquery": true,
+		"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	}
+)
+
+// Funcs are available in all templates. Time functions take the time last, so
+// they can be piped: {{ .Start | in "Europe/Berlin" | format "15:04" }}
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"xml":        escapeXml,
+		"json":       marshalJson,
+		"jsonEscape": escapeJson,
+		"now":        time.Now,
+		"utc":        func(t time.Time) time.Time { return t.UTC() },
+		"in":         in,
+		"format":     func(layout string, t time.Time) string { return t.Format(layout) },
+		"unix":       func(t time.Time) int64 { return t.Unix() },
+		"addSeconds": func(sec float64, t time.Time) time.Time { return t.Add(time.Duration(sec * float64(time.Second))) },
+	}
+}
+
+// New parses text. Legacy placeholders are converted and escaped for the
+// content type (xml or json).
+func New(name string, text string, contentType string) (*template.Template, error) {
+	return template.New(name).Funcs(Funcs()).Parse(convertLegacy(text, contentType))
+}
+
+// Render executes text with info.
+func Render(text string, contentType string, info TrackInfo) ([]byte, error) {
+	tmpl, err := New("metadata", text, contentType)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, info); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+func convertLegacy(text string, contentType string) string {
+	escape := ""
+	switch {
+	case strings.Contains(strings.ToLower(contentType), "xml"):
+		escape = " | xml"
+	case strings.Contains(strings.ToLower(contentType), "json"):
+		escape = " | jsonEscape"
+	}
+
+	funcs := Funcs()
+	return legacyPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := legacyPattern.FindStringSubmatch(placeholder)[1]
+		field, ok := legacyFields[name]
+		if key, custom := strings.CutPrefix(name, CUSTOM_PREFIX); custom && key != "" {
+			field, ok = `index .Custom "`+key+`"`, true
+		}
+		if !ok {
+			if _, function := funcs[name]; function || templateNames[name] {
+				return placeholder
+			}
+			// unknown placeholders stay as they are
+			return "{{ " + strconv.Quote(placeholder) + " }}"
+		}
+		return "{{ " + field + escape + " }}"
+	})
+}
+
+// helper
+
+func escapeXml(v any) (string, error) {
+	var b strings.Builder
+	err := xml.EscapeText(&b, []byte(toString(v)))
+	return b.String(), err
+}
+
+// marshalJson returns v as json value, strings are quoted.
+func marshalJson(v any) (string, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// escapeJson returns the content of a json string without quotes.
+func escapeJson(v any) (string, error) {
+	value, err := marshalJson(toString(v))
+	if err != nil {
+		return "", err
+	}
+	return value[1 : len(value)-1], nil
+}
+
+func in(name string, t time.Time) (time.Time, error) {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return t, err
+	}
+	return t.In(location), nil
+}
+
+func toString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,83 @@
+package template
+
+import (
+	"testing"
+	"time"
+)
+
+func testInfo() TrackInfo {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return TrackInfo{
+		Uuid:     "uuid",
+		Id:       "1",
+		Artist:   `Simon & "Garfunkel"`,
+		Title:    "<Title>",
+		Duration: 254.29,
+		TypeId:   "1",
+		TypeName: "Song",
+		Start:    start,
+		Stop:     start.Add(254290 * time.Millisecond),
+	}
+}
+
+func TestRenderLegacy(t *testing.T) {
+	text := `<e type="{{ type_id }}"><a>{{ artist }}</a><t>{{title}}</t><d>{{ duration }}</d><s>{{ start_utc }}</s><e>{{ stop_iso }}</e></e>`
+	body, err := Render(text, "xml", testInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<e type="1"><a>Simon &amp; &#34;Garfunkel&#34;</a><t>&lt;Title&gt;</t><d>254.290</d><s>2024-05-01T12:00:00Z</s><e>01.05.2024 12:04:14</e></e>`
+	if string(body) != want {
+		t.Errorf("xml:\ngot  %s\nwant %s", body, want)
+	}
+
+	body, err = Render(`{"artist": "{{ artist }}", "last": {{ last_started }}}`, "application/json", testInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"artist": "Simon & \"Garfunkel\"", "last": false}`; string(body) != want {
+		t.Errorf("json:\ngot  %s\nwant %s", body, want)
+	}
+}
+
+func TestRenderFuncs(t *testing.T) {
+	text := `{{ if eq .TypeName "Song" }}{{ .Artist | json }}{{ end }} {{ .Start | in "Europe/Berlin" | format "15:04" }} {{ .Start | addSeconds 60 | unix }}`
+	body, err := Render(text, "", testInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"Simon & \"Garfunkel\"" 14:00 1714564860`; string(body) != want {
+		t.Errorf("got %s, want %s", body, want)
+	}
+}
+
+func TestRenderChannelFields(t *testing.T) {
+	info := testInfo()
+	info.Id, info.Sequence = "42", 42
+	info.ChannelName, info.LoopCount, info.ItemIndex, info.Bitrate = "channel1", 3, 1, 128000
+	info.Custom = map[string]string{"isrc": "DE-A12-24-00001"}
+	info.Next = ItemInfo{Artist: "Next & Co", Title: "Next"}
+	info.Previous = ItemInfo{Title: "Previous"}
+
+	text := `<e id="{{ id }}" ch="{{ channel_name }}" loop="{{ loop_count }}" i="{{ item_index }}" br="{{ bitrate }}">{{ custom_isrc }}{{ custom_missing }}<n>{{ next_artist }}</n><p>{{ prev_title }}</p></e>`
+	body, err := Render(text, "xml", info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<e id="42" ch="channel1" loop="3" i="1" br="128000">DE-A12-24-00001<n>Next &amp; Co</n><p>Previous</p></e>`
+	if string(body) != want {
+		t.Errorf("got  %s\nwant %s", body, want)
+	}
+}
+
+func TestRenderUnknownLegacy(t *testing.T) {
+	text := `<e><a>{{ artist }}</a><x>{{ unknown_field }}</x>{{ if .Album }}{{ .Album }}{{ end }}</e>`
+	body, err := Render(text, "xml", testInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<e><a>Simon &amp; &#34;Garfunkel&#34;</a><x>{{ unknown_field }}</x></e>`
+	if string(body) != want {
+		t.Errorf("got  %s\nwant %s", body, want)
+	}
+}
@@ -0,0 +1,30 @@
+package uecp
+
+// charset maps non ascii characters to the RDS character set (EN 62106,
+// annex E). Other characters are replaced by '?'.
+var charset = map[rune]byte{
+	'á': 0x80, 'à': 0x81, 'é': 0x82, 'è': 0x83, 'í': 0x84, 'ì': 0x85, 'ó': 0x86, 'ò': 0x87,
+	'ú': 0x88, 'ù': 0x89, 'Ñ': 0x8A, 'Ç': 0x8B, 'Ş': 0x8C, 'ß': 0x8D, '¡': 0x8E,
+	'â': 0x90, 'ä': 0x91, 'ê': 0x92, 'ë': 0x93, 'î': 0x94, 'ï': 0x95, 'ô': 0x96, 'ö': 0x97,
+	'û': 0x98, 'ü': 0x99, 'ñ': 0x9A, 'ç': 0x9B, 'ş': 0x9C, 'ğ': 0x9D, 'ı': 0x9E,
+	'Á': 0xC0, 'À': 0xC1, 'É': 0xC2, 'È': 0xC3, 'Í': 0xC4, 'Ì': 0xC5, 'Ó': 0xC6, 'Ò': 0xC7,
+	'Ú': 0xC8, 'Ù': 0xC9,
+	'Â': 0xD0, 'Ä': 0xD1, 'Ê': 0xD2, 'Ë': 0xD3, 'Î': 0xD4, 'Ï': 0xD5, 'Ô': 0xD6, 'Ö': 0xD7,
+	'Û': 0xD8, 'Ü': 0xD9,
+}
+
+// Encode returns text in the RDS character set.
+func Encode(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r >= 0x20 && r < 0x7F:
+			encoded = append(encoded, byte(r))
+		case charset[r] != 0:
+			encoded = append(encoded, charset[r])
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
@@ -0,0 +1,148 @@
+package uecp
+
+import (
+	"strings"
+)
+
+// UECP (EBU SPB 490) frames and RDS messages.
+
+const (
+	STA byte = 0xFE
+	STP byte = 0xFF
+	ESC byte = 0xFD
+
+	MEC_PS         byte = 0x02
+	MEC_RT         byte = 0x0A
+	MEC_ODA_CONFIG byte = 0x40
+	MEC_ODA_GROUP  byte = 0x42
+
+	PS_LENGTH    int    = 8
+	RT_LENGTH    int    = 64
+	RTPLUS_AID   uint16 = 0x4BD7
+	RTPLUS_GROUP byte   = 11 << 1 // 11A
+
+	RTPLUS_TITLE  byte = 1
+	RTPLUS_ARTIST byte = 4
+)
+
+// Frame returns a frame with one message. Address is the site (10 bit) and
+// encoder (6 bit) address. Reserved bytes are escaped.
+func Frame(address uint16, sequence byte, message []byte) []byte {
+	data := []byte{byte(address >> 8), byte(address), sequence, byte(len(message))}
+	data = append(data, message...)
+	crc := Crc(data)
+	data = append(data, byte(crc>>8), byte(crc))
+
+	frame := []byte{STA}
+	for _, b := range data {
+		if b >= ESC {
+			frame = append(frame, ESC, b-ESC)
+			continue
+		}
+		frame = append(frame, b)
+	}
+	return append(frame, STP)
+}
+
+// Address returns the frame address of site and encoder.
+func Address(site int, encoder int) uint16 {
+	return uint16(site&0x3FF)<<6 | uint16(encoder&0x3F)
+}
+
+// Crc is CRC-CCITT with start value 0xFFFF, inverted.
+func Crc(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return ^crc
+}
+
+// PS returns the program service name message, padded to 8 characters.
+func PS(dsn byte, psn byte, name string) []byte {
+	ps := Encode(name)
+	if len(ps) > PS_LENGTH {
+		ps = ps[:PS_LENGTH]
+	}
+	for len(ps) < PS_LENGTH {
+		ps = append(ps, ' ')
+	}
+	return append([]byte{MEC_PS, dsn, psn}, ps...)
+}
+
+// RT returns the radiotext message. toggle is the A/B flag, which must change
+// with every new text.
+func RT(dsn byte, psn byte, text []byte, toggle bool) []byte {
+	if len(text) > RT_LENGTH {
+		text = text[:RT_LENGTH]
+	}
+	config := byte(0)
+	if toggle {
+		config |= 0x01
+	}
+	message := []byte{MEC_RT, dsn, psn, byte(len(text) + 1), config}
+	return append(message, text...)
+}
+
+// Tag is a RT+ tag marking a part of the radiotext.
+type Tag struct {
+	ContentType byte
+	Start       int
+	Length      int
+}
+
+// FindTag returns the tag of value in text or false.
+func FindTag(contentType byte, text []byte, value string) (Tag, bool) {
+	encoded := Encode(value)
+	if len(encoded) == 0 {
+		return Tag{}, false
+	}
+	start := strings.Index(string(text), string(encoded))
+	if start < 0 || start >= RT_LENGTH {
+		return Tag{}, false
+	}
+	return Tag{ContentType: contentType, Start: start, Length: min(len(encoded), RT_LENGTH-start)}, true
+}
+
+// RTPlusConfig returns the ODA configuration of RT+ in group 11A.
+func RTPlusConfig() []byte {
+	// message bits in group 3A: no CB, SCB 0, template 0
+	return []byte{MEC_ODA_CONFIG, byte(RTPLUS_AID >> 8), byte(RTPLUS_AID & 0xFF), RTPLUS_GROUP, 0x00, 0x00}
+}
+
+// RTPlus returns the ODA group with two RT+ tags. The length of the second
+// tag is limited to 32 characters. toggle changes with every item.
+func RTPlus(tag1 Tag, tag2 Tag, toggle bool, running bool) []byte {
+	var bits uint64
+	put := func(value int, size int) {
+		bits = bits<<size | uint64(value)&(1<<size-1)
+	}
+	put(boolBit(toggle), 1)
+	put(boolBit(running), 1)
+	put(int(tag1.ContentType), 6)
+	put(tag1.Start, 6)
+	put(max(tag1.Length-1, 0), 6)
+	put(int(tag2.ContentType), 6)
+	put(tag2.Start, 6)
+	put(max(min(tag2.Length, 32)-1, 0), 5)
+
+	block2 := byte(bits >> 32 & 0x1F)
+	block3 := uint16(bits >> 16)
+	block4 := uint16(bits)
+	return []byte{MEC_ODA_GROUP, byte(RTPLUS_AID >> 8), byte(RTPLUS_AID & 0xFF), RTPLUS_GROUP,
+		block2, byte(block3 >> 8), byte(block3), byte(block4 >> 8), byte(block4)}
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
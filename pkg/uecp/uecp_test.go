@@ -0,0 +1,77 @@
+package uecp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCrc(t *testing.T) {
+	if crc := Crc([]byte("123456789")); crc != 0xD64E {
+		t.Errorf("crc: got %04X, want D64E", crc)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	message := []byte{MEC_PS, 0x00, 0xFE, 'A'}
+	frame := Frame(Address(0, 1), 1, message)
+
+	if frame[0] != STA || frame[len(frame)-1] != STP {
+		t.Fatalf("start or stop missing: % X", frame)
+	}
+	if bytes.IndexByte(frame[1:len(frame)-1], STA) >= 0 || bytes.IndexByte(frame[1:len(frame)-1], STP) >= 0 {
+		t.Errorf("reserved byte not escaped: % X", frame)
+	}
+
+	// unescape and verify crc
+	data := []byte{}
+	body := frame[1 : len(frame)-1]
+	for i := 0; i < len(body); i++ {
+		if body[i] == ESC {
+			i++
+			data = append(data, ESC+body[i])
+			continue
+		}
+		data = append(data, body[i])
+	}
+	want := append([]byte{0x00, 0x01, 0x01, byte(len(message))}, message...)
+	if !bytes.Equal(data[:len(data)-2], want) {
+		t.Errorf("data: got % X, want % X", data[:len(data)-2], want)
+	}
+	crc := Crc(want)
+	if data[len(data)-2] != byte(crc>>8) || data[len(data)-1] != byte(crc) {
+		t.Errorf("crc: got % X, want %04X", data[len(data)-2:], crc)
+	}
+}
+
+func TestRT(t *testing.T) {
+	text := Encode("Björk - Jóga")
+	rt := RT(0, 0, text, true)
+	want := append([]byte{MEC_RT, 0, 0, byte(len(text) + 1), 0x01}, 'B', 'j', 0x97, 'r', 'k')
+	if !bytes.Equal(rt[:len(want)], want) {
+		t.Errorf("rt: got % X, want % X", rt[:len(want)], want)
+	}
+
+	artist, ok := FindTag(RTPLUS_ARTIST, text, "Björk")
+	if !ok || artist.Start != 0 || artist.Length != 5 {
+		t.Errorf("artist tag: got %+v", artist)
+	}
+	title, ok := FindTag(RTPLUS_TITLE, text, "Jóga")
+	if !ok || title.Start != 8 || title.Length != 4 {
+		t.Errorf("title tag: got %+v", title)
+	}
+	if _, ok := FindTag(RTPLUS_TITLE, text, "Hyperballad"); ok {
+		t.Error("tag of missing value")
+	}
+}
+
+func TestRTPlus(t *testing.T) {
+	title := Tag{ContentType: RTPLUS_TITLE, Start: 8, Length: 4}
+	artist := Tag{ContentType: RTPLUS_ARTIST, Start: 0, Length: 5}
+	group := RTPlus(title, artist, true, true)
+
+	// toggle 1, running 1, title 1/8/3, artist 4/0/4
+	want := []byte{MEC_ODA_GROUP, 0x4B, 0xD7, RTPLUS_GROUP, 0x18, 0x24, 0x06, 0x20, 0x04}
+	if !bytes.Equal(group, want) {
+		t.Errorf("rt+: got % X, want % X", group, want)
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"os"
@@ -57,3 +58,18 @@ func DownloadFile(url string, filepath string) error {
 
 	return nil
 }
+
+// Download returns the body of url. Bodies are read into memory, so
+// concurrent downloads don't share files. The download fails after timeout.
+func Download(url string, timeout time.Duration) ([]byte, error) {
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, errors.New("status code " + strconv.Itoa(resp.StatusCode))
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloadTimeout(t *testing.T) {
+	hung := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hung:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(hung)
+
+	start := time.Now()
+	data, err := Download(server.URL, 100*time.Millisecond)
+	if err == nil || data != nil {
+		t.Errorf("hung download: got %d bytes, error %v", len(data), err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("download returned after %s, want timeout of 100ms", elapsed)
+	}
+}
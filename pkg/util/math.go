@@ -140,3 +140,13 @@ func ShiftLeft(data []byte, bits int) {
 		data[n-1] <<= bits
 	}
 }
+
+// Percentile returns the p-th percentile (0-100) of sorted values using the
+// nearest rank method.
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank-1, 0), len(sorted)-1)]
+}
@@ -97,3 +97,24 @@ func TestShiftLeft(t *testing.T) {
 		t.Errorf("Right shift 5: got %q != want %q", got_shift_r5, want_shift_r5)
 	}
 }
+
+// percentile
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if got := Percentile(values, 50); got != 5 {
+		t.Errorf("p50: got %v != want %v", got, 5)
+	}
+	if got := Percentile(values, 90); got != 9 {
+		t.Errorf("p90: got %v != want %v", got, 9)
+	}
+	if got := Percentile(values, 100); got != 10 {
+		t.Errorf("p100: got %v != want %v", got, 10)
+	}
+	if got := Percentile(values, 0); got != 1 {
+		t.Errorf("p0: got %v != want %v", got, 1)
+	}
+	if got := Percentile(nil, 50); got != 0 {
+		t.Errorf("empty: got %v != want %v", got, 0)
+	}
+}